@@ -0,0 +1,299 @@
+package btree
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+// Column affinity. See "Type Affinity" in https://www.sqlite.org/datatype3.html
+type Affinity int8
+
+const (
+	BlobAffinity Affinity = iota // a.k.a. no affinity
+	TextAffinity
+	NumericAffinity
+	IntegerAffinity
+	RealAffinity
+)
+
+func (a Affinity) String() string {
+	switch a {
+	case TextAffinity:
+		return "TEXT"
+	case NumericAffinity:
+		return "NUMERIC"
+	case IntegerAffinity:
+		return "INTEGER"
+	case RealAffinity:
+		return "REAL"
+	}
+	return "BLOB"
+}
+
+func (a Affinity) IsNumeric() bool {
+	return a == NumericAffinity || a == IntegerAffinity || a == RealAffinity
+}
+
+// Determine the affinity of a declared column type, the rules are applied in order.
+func AffinityOf(declaredType string) Affinity {
+	t := strings.ToUpper(declaredType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return IntegerAffinity
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return TextAffinity
+	case strings.Contains(t, "BLOB"), strings.TrimSpace(t) == "":
+		return BlobAffinity
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return RealAffinity
+	}
+	return NumericAffinity
+}
+
+// Convert the value the way SQLite does before storing it into a column of given affinity (or before comparing).
+func (v Value) ApplyAffinity(a Affinity) Value {
+	switch a {
+	case TextAffinity:
+		if v.class == IntegerClass || v.class == RealClass {
+			return TextValue(v.Text())
+		}
+	case NumericAffinity, IntegerAffinity:
+		switch v.class {
+		case TextClass:
+			if n, ok := wellFormedNumber(string(v.data)); ok {
+				return n.ApplyAffinity(a)
+			}
+		case RealClass:
+			// a real that is exactly an integer is stored as one.
+			if v.f64 >= -9.2e18 && v.f64 <= 9.2e18 && v.f64 == math.Trunc(v.f64) {
+				return IntegerValue(int64(v.f64))
+			}
+		}
+	case RealAffinity:
+		switch v.class {
+		case TextClass:
+			if n, ok := wellFormedNumber(string(v.data)); ok {
+				return RealValue(n.Float64())
+			}
+		case IntegerClass:
+			return RealValue(float64(v.i64))
+		}
+	}
+	return v
+}
+
+// Value as a number for arithmetic; TEXT and BLOB use their longest numeric prefix (e.g. '3abc' is 3). NULL stays NULL.
+func (v Value) Numeric() Value {
+	switch v.class {
+	case TextClass, BlobClass:
+		s := string(v.data)
+		if end, isReal := scanNumberPrefix(strings.TrimLeft(s, " \t\n\r")); isReal && end > 0 {
+			f, _ := parseRealPrefix(s)
+			return RealValue(f)
+		}
+		i, _ := parseIntegerPrefix(s)
+		if i == math.MaxInt64 || i == math.MinInt64 {
+			// may have been clamped, too large for 64 bits.
+			f, _ := parseRealPrefix(s)
+			if f >= 9223372036854775808.0 || f < -9223372036854775808.0 {
+				return RealValue(f)
+			}
+		}
+		return IntegerValue(i)
+	}
+	return v
+}
+
+// Parse the text if it is a number (surrounding spaces allowed) and nothing else.
+func wellFormedNumber(s string) (Value, bool) {
+	t := strings.Trim(s, " \t\n\r")
+	end, isReal := scanNumberPrefix(t)
+	if end == 0 || end != len(t) {
+		return Value{}, false
+	}
+	if !isReal {
+		if i, whole := parseIntegerPrefix(t); whole {
+			return IntegerValue(i), true
+		}
+		// too large for 64 bits; becomes a REAL.
+	}
+	f, _ := parseRealPrefix(t)
+	return RealValue(f), true
+}
+
+// Length of the number at the start of t, and whether it is written as a real (has '.' or an exponent).
+func scanNumberPrefix(t string) (int, bool) {
+	end := 0
+	if end < len(t) && (t[end] == '+' || t[end] == '-') {
+		end++
+	}
+	digits := 0
+	for end < len(t) && t[end] >= '0' && t[end] <= '9' {
+		end++
+		digits++
+	}
+	isReal := false
+	if end < len(t) && t[end] == '.' {
+		isReal = true
+		end++
+		for end < len(t) && t[end] >= '0' && t[end] <= '9' {
+			end++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	if end < len(t) && (t[end] == 'e' || t[end] == 'E') {
+		exp := end + 1
+		if exp < len(t) && (t[exp] == '+' || t[exp] == '-') {
+			exp++
+		}
+		if exp < len(t) && t[exp] >= '0' && t[exp] <= '9' {
+			for exp < len(t) && t[exp] >= '0' && t[exp] <= '9' {
+				exp++
+			}
+			end = exp
+			isReal = true
+		}
+	}
+	return end, isReal
+}
+
+// Order two values the way SQLite sorts them: NULL < INTEGER/REAL < TEXT < BLOB.
+// Numbers compare by value across INTEGER and REAL; TEXT and BLOB compare bytewise (BINARY collation).
+func Compare(a, b Value) int {
+	ra, rb := classRank(a.class), classRank(b.class)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch a.class {
+	case NullClass:
+		return 0
+	case IntegerClass, RealClass:
+		return compareNumbers(a, b)
+	}
+	return bytes.Compare(a.data, b.data)
+}
+
+// Like Compare, but TEXT compares by the named collation: BINARY, NOCASE (ASCII letters case folded)
+// or RTRIM (trailing spaces ignored). Other names compare as BINARY.
+func CompareCollated(a, b Value, collation string) int {
+	if a.class != TextClass || b.class != TextClass {
+		return Compare(a, b)
+	}
+	switch strings.ToUpper(collation) {
+	case "NOCASE":
+		return compareNoCase(a.data, b.data)
+	case "RTRIM":
+		return bytes.Compare(bytes.TrimRight(a.data, " "), bytes.TrimRight(b.data, " "))
+	}
+	return bytes.Compare(a.data, b.data)
+}
+
+// The value that equals (by BINARY) the values that equal it by the collation, for hashing. e.g. 'abc' for 'ABC'
+// by NOCASE, 'a' for 'a  ' by RTRIM.
+func CollationKey(v Value, collation string) Value {
+	if v.class != TextClass {
+		return v
+	}
+	switch strings.ToUpper(collation) {
+	case "NOCASE":
+		folded := make([]byte, len(v.data))
+		for i, ch := range v.data {
+			if 'A' <= ch && ch <= 'Z' {
+				ch += 'a' - 'A'
+			}
+			folded[i] = ch
+		}
+		return Value{class: TextClass, data: folded}
+	case "RTRIM":
+		return Value{class: TextClass, data: bytes.TrimRight(v.data, " ")}
+	}
+	return v
+}
+
+func compareNoCase(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return compareInt64(int64(len(a)), int64(len(b)))
+}
+
+func classRank(c StorageClass) int {
+	switch c {
+	case NullClass:
+		return 0
+	case IntegerClass, RealClass:
+		return 1
+	case TextClass:
+		return 2
+	}
+	return 3
+}
+
+func compareNumbers(a, b Value) int {
+	if a.class == IntegerClass && b.class == IntegerClass {
+		return compareInt64(a.i64, b.i64)
+	}
+	if a.class == RealClass && b.class == RealClass {
+		return compareFloat64(a.f64, b.f64)
+	}
+	if a.class == RealClass {
+		return -compareIntReal(b.i64, a.f64)
+	}
+	return compareIntReal(a.i64, b.f64)
+}
+
+// Exact comparison, float64(i) would lose precision for large integers.
+func compareIntReal(i int64, f float64) int {
+	switch {
+	case math.IsNaN(f):
+		return 1
+	case f < -9223372036854775808.0:
+		return 1
+	case f >= 9223372036854775808.0:
+		return -1
+	}
+	if c := compareInt64(i, int64(f)); c != 0 {
+		return c
+	}
+	// same integral part, the fraction decides.
+	return compareFloat64(0, f-math.Trunc(f))
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 )
 
 type BTreePageType = int8
@@ -43,7 +44,7 @@ type TableBTreeLeafTablePageCell struct {
 	payloadSize  int64
 	Rowid        int64
 	Fields       []TableBTreeLeafPageCellField
-	overflowPage int32
+	overflowPage uint32 // first overflow page (0 = none)
 }
 
 type IndexPayload interface {
@@ -54,8 +55,7 @@ type IndexPayload interface {
 type TableBTreeLeafIndexPageCell struct {
 	payloadSize  int64
 	fields       []TableBTreeLeafPageCellField
-	overflowPage int32
-	IndexStrain  string // the fields concaternated logically.
+	overflowPage uint32 // first overflow page (0 = none)
 }
 
 type TableBTreeInteriorPageCell struct {
@@ -64,11 +64,10 @@ type TableBTreeInteriorPageCell struct {
 }
 
 type TableBTreeIndexInteriorPageCell struct {
-	MaxIndexStrain string
 	payloadSize    int64
 	fields         []TableBTreeLeafPageCellField
 	LeftPageNumber uint32
-	overflowPage   int32
+	overflowPage   uint32 // first overflow page (0 = none)
 }
 
 func (iipc *TableBTreeIndexInteriorPageCell) Fields() []TableBTreeLeafPageCellField {
@@ -79,41 +78,67 @@ func (iipc *TableBTreeLeafIndexPageCell) Fields() []TableBTreeLeafPageCellField
 	return iipc.fields
 }
 
-func (f *TableBTreeLeafPageCellField) String() string {
+// Typed value of this field.
+func (f *TableBTreeLeafPageCellField) Value() Value {
 	switch f.serialType {
-	case STRING:
-		return string(f.data)
 	case Null:
-		return "<null>"
-	case I0:
-		return "0"
-	case I1:
-		return "1"
+		return NullValue()
+	case F64:
+		return RealValue(math.Float64frombits(binary.BigEndian.Uint64(f.data)))
+	case BLOB:
+		return BlobValue(f.data)
+	case STRING:
+		return TextValue(string(f.data))
 	default:
-		i64 := f.Integer()
-		return fmt.Sprintf("%d", i64)
+		return IntegerValue(f.Integer())
 	}
 }
 
+func (f *TableBTreeLeafPageCellField) IsNull() bool {
+	return f.serialType == Null
+}
+
+func (f *TableBTreeLeafPageCellField) Float64() float64 {
+	return f.Value().Float64()
+}
+
+func (f *TableBTreeLeafPageCellField) Bytes() []byte {
+	return f.Value().Bytes()
+}
+
+func (f *TableBTreeLeafPageCellField) Text() string {
+	return f.Value().Text()
+}
+
+// Render the field the way sqlite3 does. (NULL is an empty string)
+func (f *TableBTreeLeafPageCellField) String() string {
+	return f.Value().String()
+}
+
+// Integer serial types (I8..I64) are big-endian two's-complement.
 func (f *TableBTreeLeafPageCellField) Integer() int64 {
-	// This code would be easier for compiler to optimize?
 	switch f.serialType {
-	case I8:
-		return int64(f.data[0]) // size = 1 byte
-	case I16:
-		return int64(f.data[0])<<8 | int64(f.data[1]) // size = 2 bytes
-	case I24:
-		return int64(f.data[0])<<16 | int64(f.data[1])<<8 | int64(f.data[2]) // size = 3 bytes
-	case I32:
-		return int64(f.data[0])<<24 | int64(f.data[1])<<16 | int64(f.data[2])<<8 | int64(f.data[3]) // size = 4 bytes
-	case I48:
-		return int64(f.data[0])<<40 | int64(f.data[1])<<32 | int64(f.data[2])<<24 | int64(f.data[3])<<16 | int64(f.data[4])<<8 | int64(f.data[5]) // size = 6 bytes
-	case I64:
-		return int64(f.data[0])<<56 | int64(f.data[1])<<48 | int64(f.data[2])<<40 | int64(f.data[3])<<32 | int64(f.data[4])<<24 | int64(f.data[5])<<16 | int64(f.data[6])<<8 | int64(f.data[7]) // size = 8 bytes
+	case Null:
+		return 0
+	case I0:
+		return 0
+	case I1:
+		return 1
+	case I8, I16, I24, I32, I48, I64:
+		return decodeSignedBigEndian(f.data)
+	}
+	return f.Value().Integer()
+}
+
+// Decode 1..8 bytes of big-endian two's-complement integer; the sign bit of the first byte is extended.
+func decodeSignedBigEndian(data []byte) int64 {
+	var i64 int64
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		i64 = -1 // all bits set; will be shifted out by the actual bytes.
+	}
+	for _, b := range data {
+		i64 = i64<<8 | int64(b)
 	}
-	var i64 = int64(0)
-	reader := bytes.NewReader(f.data)
-	binary.Read(reader, binary.BigEndian, &i64)
 	return i64
 }
 
@@ -149,13 +174,22 @@ func mapSerialType(rawSerialType int64) (BTreeLeafPageCellSerialType, int64, err
 	return Null, 0, errors.New(fmt.Sprintf("unsupported serial type %d", rawSerialType))
 }
 
-func parseCellRecordFormat(reader *bytes.Reader, payloadSize int64) ([]TableBTreeLeafPageCellField, error) {
+// Parse the record format from the complete payload (including the parts that spilled onto overflow pages).
+func parseCellRecordFormat(payload []byte) ([]TableBTreeLeafPageCellField, error) {
+	reader := bytes.NewReader(payload)
+	payloadSize := int64(len(payload))
 	readBytes := int64(0)
 	headerTotalBytes, n, err := ReadVarint(reader)
 	if err != nil {
 		return nil, err
 	}
 	readBytes += int64(n)
+	if headerTotalBytes < 1 {
+		return nil, fmt.Errorf("record header of %d bytes", headerTotalBytes)
+	}
+	if headerTotalBytes > payloadSize {
+		return nil, fmt.Errorf("record header of %d bytes exceeds payload of %d bytes", headerTotalBytes, payloadSize)
+	}
 	out := make([]TableBTreeLeafPageCellField, headerTotalBytes) // will never exceed this totalBytes anyway.
 	fieldsCount := 0
 	// Parse Cell Header
@@ -184,23 +218,11 @@ func parseCellRecordFormat(reader *bytes.Reader, payloadSize int64) ([]TableBTre
 		if proto.contentSize <= 0 {
 			continue
 		}
-		readSize := proto.contentSize
-		readBytesLookAhead := readBytes + proto.contentSize
-		// Is this correct? It seems some of the `contentSize` is overshoot the expected totalBytes to be read. Hence this
-		// If block contain the unexpected overflow :(
-		if readBytesLookAhead > payloadSize {
-			// fmt.Printf("WARNING READ OVERFLOW by %d - %d = %d!\n", readBytesLookAhead, payloadSize, readBytesLookAhead-payloadSize)
-			readSize -= (readBytesLookAhead - payloadSize)
-			// fmt.Printf("Correction will read %d\n", readSize)
-		}
-		readBytes += readSize
-
-		valueArr := make([]byte, readSize)
-		_, err := reader.Read(valueArr)
-		if err != nil {
-			return nil, err
+		if readBytes+proto.contentSize > payloadSize {
+			return nil, fmt.Errorf("field %d of %d bytes runs past the payload of %d bytes", j, proto.contentSize, payloadSize)
 		}
-		out[j].data = valueArr
+		out[j].data = payload[readBytes : readBytes+proto.contentSize]
+		readBytes += proto.contentSize
 	}
 	return out[0:fieldsCount], nil
 }
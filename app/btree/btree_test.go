@@ -0,0 +1,140 @@
+package btree
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDecodeSignedBigEndian(t *testing.T) {
+	widths := []struct {
+		serialType BTreeLeafPageCellSerialType
+		size       int
+	}{
+		{I8, 1}, {I16, 2}, {I24, 3}, {I32, 4}, {I48, 6}, {I64, 8},
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, w := range widths {
+		bits := uint(8 * w.size)
+		maxValue := int64(math.MaxInt64)
+		minValue := int64(math.MinInt64)
+		if bits < 64 {
+			maxValue = 1<<(bits-1) - 1
+			minValue = -1 << (bits - 1)
+		}
+		values := []int64{minValue, maxValue, -1, 0, minValue + 1, maxValue - 1}
+		for i := 0; i < 100; i++ {
+			// random values of this width, negative ones included.
+			v := random.Int63()
+			if bits < 64 {
+				v = v%(maxValue-minValue+1) + minValue
+			} else if random.Intn(2) == 0 {
+				v = -v - 1
+			}
+			values = append(values, v)
+		}
+		for _, v := range values {
+			data := make([]byte, w.size)
+			for b := 0; b < w.size; b++ {
+				data[b] = byte(v >> (8 * (w.size - 1 - b)))
+			}
+			if got := decodeSignedBigEndian(data); got != v {
+				t.Errorf("width %d: decodeSignedBigEndian(% x) = %d, want %d", w.size, data, got, v)
+			}
+			field := TableBTreeLeafPageCellField{serialType: w.serialType, contentSize: int64(w.size), data: data}
+			if got := field.Integer(); got != v {
+				t.Errorf("width %d: field of % x = %d, want %d", w.size, data, got, v)
+			}
+		}
+	}
+	if got := decodeSignedBigEndian([]byte{0xFF}); got != -1 {
+		t.Errorf("I8 0xff = %d, want -1", got)
+	}
+}
+
+// Integers go through the record format in the smallest serial type that fits, and come back the same.
+func TestRecordIntegerRoundTrip(t *testing.T) {
+	var values []Value
+	for _, bits := range []uint{8, 16, 24, 32, 48, 64} {
+		maxValue := int64(math.MaxInt64)
+		minValue := int64(math.MinInt64)
+		if bits < 64 {
+			maxValue = 1<<(bits-1) - 1
+			minValue = -1 << (bits - 1)
+		}
+		values = append(values, IntegerValue(minValue), IntegerValue(maxValue))
+		if bits < 64 {
+			// just outside of this width, the next one.
+			values = append(values, IntegerValue(minValue-1), IntegerValue(maxValue+1))
+		}
+	}
+	values = append(values, IntegerValue(-1), IntegerValue(0), IntegerValue(1), IntegerValue(2))
+	decoded, err := DecodeRecord(EncodeRecord(values))
+	if err != nil {
+		t.Fatalf("DecodeRecord failed: %v", err)
+	}
+	if len(decoded) != len(values) {
+		t.Fatalf("decoded %d values, want %d", len(decoded), len(values))
+	}
+	for i, v := range values {
+		if decoded[i].Class() != IntegerClass || decoded[i].Integer() != v.Integer() {
+			t.Errorf("value %d: decoded %v (%s), want %d", i, decoded[i], decoded[i].Class(), v.Integer())
+		}
+	}
+}
+
+func TestSerialTypeSizes(t *testing.T) {
+	cases := []struct {
+		v          int64
+		serialType BTreeLeafPageCellSerialType
+		size       int
+	}{
+		{0, I0, 0}, {1, I1, 0}, {-1, I8, 1}, {127, I8, 1}, {-128, I8, 1}, {128, I16, 2},
+		{-32769, I24, 3}, {8388608, I32, 4}, {2147483648, I48, 6}, {-140737488355329, I64, 8},
+	}
+	for _, c := range cases {
+		serialType, size := serialTypeOf(IntegerValue(c.v))
+		if serialType != int64(c.serialType) || size != c.size {
+			t.Errorf("serialTypeOf(%d) = %d, %d; want %d, %d", c.v, serialType, size, c.serialType, c.size)
+		}
+		mapped, contentSize, err := mapSerialType(serialType)
+		if err != nil || mapped != c.serialType || contentSize != int64(c.size) {
+			t.Errorf("mapSerialType(%d) = %d, %d, %v; want %d, %d", serialType, mapped, contentSize, err, c.serialType, c.size)
+		}
+	}
+}
+
+type fakePager struct{ size int }
+
+func (f fakePager) UsableSize() int                    { return f.size }
+func (f fakePager) ReadRawPage(uint32) ([]byte, error) { return make([]byte, f.size), nil }
+func (f fakePager) DatabaseSize() int64                { return int64(f.size) }
+
+// Sizes from a corrupt 9 bytes varint are errors, not slice bounds panics.
+func TestCorruptSizes(t *testing.T) {
+	nineFF := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	if _, err := DecodeRecord(append(append([]byte{}, nineFF...), 0x01)); err == nil {
+		t.Errorf("DecodeRecord of a negative header size succeeded")
+	}
+	if _, err := DecodeRecord([]byte{0x00}); err == nil {
+		t.Errorf("DecodeRecord of an empty header succeeded")
+	}
+	for _, payloadSize := range [][]byte{nineFF, {0x87, 0xFF, 0xFF, 0x7F}} {
+		// a table leaf page of one cell: the payload size, rowid 1, then a bit of payload.
+		content := make([]byte, 512)
+		content[0] = byte(LeafTable)
+		content[4] = 1
+		content[8], content[9] = 0x01, 0x00
+		cell := append(append([]byte{}, payloadSize...), 0x01, 0x02, 0x01)
+		copy(content[256:], cell)
+		page, err := ParseBTreePage(content, false, fakePager{size: 512})
+		if err != nil {
+			t.Fatalf("ParseBTreePage failed: %v", err)
+		}
+		var formatErr *FormatError
+		if _, err := page.ReadTableLeafCell(0, -1); !errors.As(err, &formatErr) {
+			t.Errorf("payload size % x: got %v, want a FormatError", payloadSize, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package btree
+
+import "fmt"
+
+// Malformed content found while reading a page.
+type FormatError struct {
+	Offset int   // bytes from the start of the page content
+	Err    error // what was wrong
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("malformed page content at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+func formatError(offset int, err error) error {
+	if _, ok := err.(*FormatError); ok {
+		return err
+	}
+	return &FormatError{Offset: offset, Err: err}
+}
@@ -3,29 +3,45 @@ package btree
 import (
 	"bytes"
 	"encoding/binary"
-	"strings"
+	"fmt"
 )
 
 type TableBTreePageHeader struct {
 	PageType                    BTreePageType
-	freeBlocksOffset            int16
-	NumberOfCells               int16
-	cellContentOffset           int16
+	freeBlocksOffset            uint16
+	NumberOfCells               uint16
+	cellContentOffset           uint16 // 0 means 65536
 	numberOfFragmentedFreeBytes int8
 	RightMostPointer            uint32 // only available in BTreePage
 }
 
 type TableBTreePage struct {
 	Header      TableBTreePageHeader
-	CellOffsets []int16
+	CellOffsets []uint16
 	pageContent []byte // original pageContent
+	pager       Pager  // used for following the overflow pages.
 }
 
-func ParseBTreePage(pageContent []byte, isFirstPage bool) (*TableBTreePage, error) {
+// Gives a page access to the rest of the database file. (e.g. reading overflow pages)
+type Pager interface {
+	UsableSize() int                               // page size minus the reserved bytes at the end of each page.
+	ReadRawPage(pageNumber uint32) ([]byte, error) // whole page content as is (pageNumber starts from 1)
+	DatabaseSize() int64                           // bytes of the database file, no payload can be larger.
+}
+
+func ParseBTreePage(pageContent []byte, isFirstPage bool, pager Pager) (*TableBTreePage, error) {
+	if len(pageContent) < 12 {
+		return nil, formatError(0, fmt.Errorf("page of %d bytes is too short", len(pageContent)))
+	}
 	// get first byte for determine the type.
 	pageType := int8(pageContent[0])
+	switch pageType {
+	case InteriorIndex, InteriorTable, LeafIndex, LeafTable:
+	default:
+		return nil, formatError(0, fmt.Errorf("invalid page type %#x", pageType))
+	}
 	numberOfFragmentedFreeBytes := int8(pageContent[7])
-	params := [3]int16{0, 0, 0}
+	params := [3]uint16{0, 0, 0}
 	if err := binary.Read(bytes.NewReader(pageContent[1:7]), binary.BigEndian, &params); err != nil {
 		return nil, err
 	}
@@ -38,7 +54,7 @@ func ParseBTreePage(pageContent []byte, isFirstPage bool) (*TableBTreePage, erro
 		numberOfFragmentedFreeBytes: numberOfFragmentedFreeBytes,
 		RightMostPointer:            0, // optional
 	}
-	cellPointsArrayOffset := int16(8)
+	cellPointsArrayOffset := uint16(8)
 
 	if InteriorTable == pageType || InteriorIndex == pageType {
 		if err := binary.Read(bytes.NewReader(pageContent[8:12]), binary.BigEndian, &(header.RightMostPointer)); err != nil {
@@ -47,15 +63,24 @@ func ParseBTreePage(pageContent []byte, isFirstPage bool) (*TableBTreePage, erro
 		cellPointsArrayOffset = 12
 	}
 
-	cellOffsets := make([]int16, header.NumberOfCells)
-	if err := binary.Read(bytes.NewReader(pageContent[cellPointsArrayOffset:cellPointsArrayOffset+2*header.NumberOfCells]), binary.BigEndian, &cellOffsets); err != nil {
-		return nil, err
+	cellPointersEnd := int(cellPointsArrayOffset) + 2*int(header.NumberOfCells)
+	if cellPointersEnd > len(pageContent) {
+		return nil, formatError(int(cellPointsArrayOffset), fmt.Errorf("%d cell pointers do not fit in the page", header.NumberOfCells))
+	}
+	cellOffsets := make([]uint16, header.NumberOfCells)
+	if err := binary.Read(bytes.NewReader(pageContent[cellPointsArrayOffset:cellPointersEnd]), binary.BigEndian, &cellOffsets); err != nil {
+		return nil, formatError(int(cellPointsArrayOffset), err)
 	}
 
 	// in case of first page, need to compensate the header offsets.
 	if isFirstPage {
 		for i := 0; i < len(cellOffsets); i++ {
-			cellOffsets[i] -= int16(100)
+			cellOffsets[i] -= uint16(100)
+		}
+	}
+	for i, offset := range cellOffsets {
+		if int(offset) < cellPointersEnd || int(offset) >= len(pageContent) {
+			return nil, formatError(int(cellPointsArrayOffset)+2*i, fmt.Errorf("cell %d points outside of the cell content area (%d)", i, offset))
 		}
 	}
 
@@ -63,9 +88,83 @@ func ParseBTreePage(pageContent []byte, isFirstPage bool) (*TableBTreePage, erro
 		Header:      *header,
 		CellOffsets: cellOffsets,
 		pageContent: pageContent,
+		pager:       pager,
 	}, nil
 }
 
+// Determine how many bytes of the payload are stored on this page itself. The rest spills to overflow pages.
+//
+// See "Cell Payload Overflow Pages" in https://www.sqlite.org/fileformat.html
+func (p *TableBTreePage) localPayloadSize(payloadSize int64) int64 {
+	u := int64(p.pager.UsableSize())
+	maxLocal := u - 35 // X for table leaf
+	if p.Header.PageType != LeafTable {
+		maxLocal = ((u-12)*64/255 - 23) // X for index pages (leaf & interior)
+	}
+	if payloadSize <= maxLocal {
+		return payloadSize
+	}
+	minLocal := ((u-12)*32/255 - 23)
+	k := minLocal + (payloadSize-minLocal)%(u-4)
+	if k <= maxLocal {
+		return k
+	}
+	return minLocal
+}
+
+// Read the whole payload which start at `offset` of this page. Returns the payload and the first overflow page number (0 means no overflow).
+//
+// * The initial portion of the payload that does not spill to overflow pages.
+// * A 4-byte big-endian integer page number for the first page of the overflow page list
+// * Each overflow page: 4-byte next page number (0 = last page) followed by (usableSize - 4) bytes of content.
+func (p *TableBTreePage) readPayload(offset int, payloadSize int64) ([]byte, uint32, error) {
+	// a corrupt varint may say anything.
+	if payloadSize < 0 || payloadSize > p.pager.DatabaseSize() {
+		return nil, 0, fmt.Errorf("payload of %d bytes does not fit in the database", payloadSize)
+	}
+	local := p.localPayloadSize(payloadSize)
+	end := offset + int(local)
+	if end > len(p.pageContent) {
+		return nil, 0, fmt.Errorf("payload of %d bytes at offset %d runs past the end of page", payloadSize, offset)
+	}
+	if local == payloadSize {
+		return p.pageContent[offset:end], 0, nil
+	}
+	if end+4 > len(p.pageContent) {
+		return nil, 0, fmt.Errorf("overflow pointer at offset %d runs past the end of page", end)
+	}
+	firstOverflowPage := binary.BigEndian.Uint32(p.pageContent[end : end+4])
+
+	payload := make([]byte, 0, payloadSize)
+	payload = append(payload, p.pageContent[offset:end]...)
+	usableSize := p.pager.UsableSize()
+	nextPage := firstOverflowPage
+	for int64(len(payload)) < payloadSize {
+		if nextPage == 0 {
+			return nil, 0, fmt.Errorf("overflow chain ended after %d of %d bytes", len(payload), payloadSize)
+		}
+		raw, err := p.pager.ReadRawPage(nextPage)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(raw) < usableSize {
+			return nil, 0, fmt.Errorf("overflow page %d is truncated", nextPage)
+		}
+		chunk := raw[4:usableSize]
+		if remaining := payloadSize - int64(len(payload)); int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+		nextPage = binary.BigEndian.Uint32(raw[0:4])
+	}
+	return payload, firstOverflowPage, nil
+}
+
+// number of bytes consumed from the reader which was created from `p.pageContent[start:]`
+func consumed(reader *bytes.Reader) int {
+	return int(reader.Size()) - reader.Len()
+}
+
 // Reading "Cell Content"
 // ===
 
@@ -76,24 +175,28 @@ func ParseBTreePage(pageContent []byte, isFirstPage bool) (*TableBTreePage, erro
 // * A varint which is the total number of bytes of payload, including any overflow
 // * A varint which is the integer key, a.k.a. "rowid"
 // * The initial portion of the payload that does not spill to overflow pages.
-// * A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page. (FIXME)
+// * A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page.
 func (p *TableBTreePage) ReadTableLeafCell(cellIndex int, rowidAliasIndex int) (*TableBTreeLeafTablePageCell, error) {
-	contentOffset := p.CellOffsets[cellIndex]
+	contentOffset := int(p.CellOffsets[cellIndex])
 	reader := bytes.NewReader(p.pageContent[contentOffset:])
 	payloadSize, _, err := ReadVarint(reader) // including its' corresponding headers
 	if err != nil {
-		return nil, err
+		return nil, formatError(contentOffset, err)
 	}
 	rowid, _, err := ReadVarint(reader)
 	if err != nil {
-		return nil, err
+		return nil, formatError(contentOffset, err)
 	}
-	content, err := parseCellRecordFormat(reader, payloadSize)
+	payload, overflowPage, err := p.readPayload(contentOffset+consumed(reader), payloadSize)
 	if err != nil {
-		return nil, err
+		return nil, formatError(contentOffset, err)
+	}
+	content, err := parseCellRecordFormat(payload)
+	if err != nil {
+		return nil, formatError(contentOffset, err)
 	}
 
-	if rowidAliasIndex >= 0 {
+	if rowidAliasIndex >= 0 && rowidAliasIndex < len(content) {
 		content[rowidAliasIndex].isRowIdAlias = true
 	}
 
@@ -101,35 +204,43 @@ func (p *TableBTreePage) ReadTableLeafCell(cellIndex int, rowidAliasIndex int) (
 		payloadSize:  payloadSize,
 		Rowid:        rowid,
 		Fields:       content,
-		overflowPage: 0,
+		overflowPage: overflowPage,
 	}, nil
 }
 
+// Only the rowid of a cell in TableLeafPage, without reading its payload.
+func (p *TableBTreePage) ReadTableLeafRowid(cellIndex int) (int64, error) {
+	contentOffset := int(p.CellOffsets[cellIndex])
+	reader := bytes.NewReader(p.pageContent[contentOffset:])
+	if _, _, err := ReadVarint(reader); err != nil {
+		return 0, formatError(contentOffset, err)
+	}
+	rowid, _, err := ReadVarint(reader)
+	if err != nil {
+		return 0, formatError(contentOffset, err)
+	}
+	return rowid, nil
+}
+
 func (p *TableBTreePage) ReadIndexLeafCell(cellIndex int) (*TableBTreeLeafIndexPageCell, error) {
-	contentOffset := p.CellOffsets[cellIndex]
+	contentOffset := int(p.CellOffsets[cellIndex])
 	reader := bytes.NewReader(p.pageContent[contentOffset:])
 	payloadSize, _, err := ReadVarint(reader) // including its' corresponding headers
 	if err != nil {
-		return nil, err
+		return nil, formatError(contentOffset, err)
 	}
-	content, err := parseCellRecordFormat(reader, payloadSize)
+	payload, overflowPage, err := p.readPayload(contentOffset+consumed(reader), payloadSize)
 	if err != nil {
-		return nil, err
+		return nil, formatError(contentOffset, err)
 	}
-	var b strings.Builder
-	for c, cnt := range content {
-		if c > 0 {
-			b.WriteString("|")
-		}
-		b.WriteString(cnt.String())
-		// b.WriteString(fmt.Sprintf("(%d|%d=%s", d, cnt.serialType, cnt.String()))
+	content, err := parseCellRecordFormat(payload)
+	if err != nil {
+		return nil, formatError(contentOffset, err)
 	}
-
 	return &TableBTreeLeafIndexPageCell{
 		payloadSize:  payloadSize,
 		fields:       content,
-		IndexStrain:  b.String(),
-		overflowPage: 0,
+		overflowPage: overflowPage,
 	}, nil
 }
 
@@ -152,6 +263,9 @@ func (p *TableBTreePage) ReadAllTableInteriorCells() ([]TableBTreeInteriorPageCe
 // * A 4-byte big-endian page number which is the left child pointer.
 // * A varint which is the integer key
 func (p *TableBTreePage) ReadTableInteriorCell(cellOffset int) (*TableBTreeInteriorPageCell, error) {
+	if cellOffset+4 > len(p.pageContent) {
+		return nil, formatError(cellOffset, fmt.Errorf("interior cell runs past the end of page"))
+	}
 	var i32 = uint32(0) // 4 bytes
 	i32Reader := bytes.NewReader(p.pageContent[cellOffset : cellOffset+4])
 	binary.Read(i32Reader, binary.BigEndian, &i32)
@@ -159,7 +273,7 @@ func (p *TableBTreePage) ReadTableInteriorCell(cellOffset int) (*TableBTreeInter
 	reader := bytes.NewReader(p.pageContent[cellOffset+4:])
 	rowid, _, err := ReadVarint(reader)
 	if err != nil {
-		return nil, err
+		return nil, formatError(cellOffset, err)
 	}
 	return &TableBTreeInteriorPageCell{
 		Rowid:          rowid,
@@ -171,8 +285,11 @@ func (p *TableBTreePage) ReadTableInteriorCell(cellOffset int) (*TableBTreeInter
 // - A 4-byte big-endian page number which is the left child pointer.
 // - A varint which is the total number of bytes of key payload, including any overflow
 // - The initial portion of the payload that does not spill to overflow pages.
-// - A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page. (FIXME)
-func (p *TableBTreePage) ReadIndexInteriorCell(cellOffset int16) (*TableBTreeIndexInteriorPageCell, error) {
+// - A 4-byte big-endian integer page number for the first page of the overflow page list - omitted if all payload fits on the b-tree page.
+func (p *TableBTreePage) ReadIndexInteriorCell(cellOffset uint16) (*TableBTreeIndexInteriorPageCell, error) {
+	if int(cellOffset)+4 > len(p.pageContent) {
+		return nil, formatError(int(cellOffset), fmt.Errorf("interior cell runs past the end of page"))
+	}
 	// pageNumber of Left Child
 	var leftPageNumber = uint32(0) // 4 bytes
 	i32Reader := bytes.NewReader(p.pageContent[cellOffset : cellOffset+4])
@@ -182,23 +299,21 @@ func (p *TableBTreePage) ReadIndexInteriorCell(cellOffset int16) (*TableBTreeInd
 	reader := bytes.NewReader(p.pageContent[cellOffset+4:])
 	payloadSize, _, err := ReadVarint(reader)
 	if err != nil {
-		return nil, err
+		return nil, formatError(int(cellOffset), err)
 	}
 	// read payloads based on Payload Size
-	content, err := parseCellRecordFormat(reader, payloadSize)
-	var b strings.Builder
-	for c, cnt := range content {
-		if c > 0 {
-			b.WriteString("|")
-		}
-		b.WriteString(cnt.String())
-		// b.WriteString(fmt.Sprintf("(%d|%d=%s", d, cnt.serialType, cnt.String()))
+	payload, overflowPage, err := p.readPayload(int(cellOffset)+4+consumed(reader), payloadSize)
+	if err != nil {
+		return nil, formatError(int(cellOffset), err)
+	}
+	content, err := parseCellRecordFormat(payload)
+	if err != nil {
+		return nil, formatError(int(cellOffset), err)
 	}
 	return &TableBTreeIndexInteriorPageCell{
 		LeftPageNumber: leftPageNumber,
 		fields:         content,
 		payloadSize:    payloadSize,
-		MaxIndexStrain: b.String(),
-		overflowPage:   0,
+		overflowPage:   overflowPage,
 	}, nil
 }
@@ -0,0 +1,107 @@
+package btree
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Encode values in the record format. (header of serial types followed by the content)
+//
+// See "Record Format" in https://www.sqlite.org/fileformat.html
+func EncodeRecord(values []Value) []byte {
+	serialTypes := make([]int64, len(values))
+	headerSize := 0
+	bodySize := 0
+	for i, v := range values {
+		serialType, contentSize := serialTypeOf(v)
+		serialTypes[i] = serialType
+		headerSize += VarintLen(serialType)
+		bodySize += contentSize
+	}
+	// the header size includes the varint of the header size itself.
+	total := headerSize + VarintLen(int64(headerSize))
+	if VarintLen(int64(total)) != VarintLen(int64(headerSize)) {
+		total = headerSize + VarintLen(int64(total))
+	}
+	buf := make([]byte, 0, total+bodySize)
+	buf = AppendVarint(buf, int64(total))
+	for _, serialType := range serialTypes {
+		buf = AppendVarint(buf, serialType)
+	}
+	for i, v := range values {
+		switch v.class {
+		case IntegerClass:
+			size := integerSize(serialTypes[i])
+			for b := size - 1; b >= 0; b-- {
+				buf = append(buf, byte(v.i64>>(8*b)))
+			}
+		case RealClass:
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v.f64))
+		case TextClass, BlobClass:
+			buf = append(buf, v.data...)
+		}
+	}
+	return buf
+}
+
+// Decode a record produced by EncodeRecord (or read from a page) back into values.
+func DecodeRecord(payload []byte) ([]Value, error) {
+	fields, err := parseCellRecordFormat(payload)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, len(fields))
+	for i := range fields {
+		values[i] = fields[i].Value()
+	}
+	return values, nil
+}
+
+// The serial type (smallest one that fits) and the number of content bytes.
+func serialTypeOf(v Value) (int64, int) {
+	switch v.class {
+	case IntegerClass:
+		switch i := v.i64; {
+		case i == 0:
+			return int64(I0), 0
+		case i == 1:
+			return int64(I1), 0
+		case i >= -128 && i <= 127:
+			return int64(I8), 1
+		case i >= -32768 && i <= 32767:
+			return int64(I16), 2
+		case i >= -8388608 && i <= 8388607:
+			return int64(I24), 3
+		case i >= -2147483648 && i <= 2147483647:
+			return int64(I32), 4
+		case i >= -140737488355328 && i <= 140737488355327:
+			return int64(I48), 6
+		}
+		return int64(I64), 8
+	case RealClass:
+		return int64(F64), 8
+	case TextClass:
+		return int64(len(v.data))*2 + 13, len(v.data)
+	case BlobClass:
+		return int64(len(v.data))*2 + 12, len(v.data)
+	}
+	return int64(Null), 0
+}
+
+func integerSize(serialType int64) int {
+	switch serialType {
+	case int64(I8):
+		return 1
+	case int64(I16):
+		return 2
+	case int64(I24):
+		return 3
+	case int64(I32):
+		return 4
+	case int64(I48):
+		return 6
+	case int64(I64):
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,224 @@
+package btree
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Storage class of a value. See "Storage Classes and Datatypes" in https://www.sqlite.org/datatype3.html
+type StorageClass int8
+
+const (
+	NullClass StorageClass = iota
+	IntegerClass
+	RealClass
+	TextClass
+	BlobClass
+)
+
+func (c StorageClass) String() string {
+	switch c {
+	case IntegerClass:
+		return "integer"
+	case RealClass:
+		return "real"
+	case TextClass:
+		return "text"
+	case BlobClass:
+		return "blob"
+	}
+	return "null"
+}
+
+// A single typed value (e.g. a field of a record).
+type Value struct {
+	class StorageClass
+	i64   int64
+	f64   float64
+	data  []byte // TEXT and BLOB content
+}
+
+func NullValue() Value {
+	return Value{class: NullClass}
+}
+
+func IntegerValue(i int64) Value {
+	return Value{class: IntegerClass, i64: i}
+}
+
+func RealValue(f float64) Value {
+	return Value{class: RealClass, f64: f}
+}
+
+func TextValue(s string) Value {
+	return Value{class: TextClass, data: []byte(s)}
+}
+
+func BlobValue(b []byte) Value {
+	return Value{class: BlobClass, data: b}
+}
+
+func (v Value) Class() StorageClass {
+	return v.class
+}
+
+func (v Value) IsNull() bool {
+	return v.class == NullClass
+}
+
+// Value as an integer. (Same conversion as sqlite3_value_int64)
+func (v Value) Integer() int64 {
+	switch v.class {
+	case IntegerClass:
+		return v.i64
+	case RealClass:
+		return realToInteger(v.f64)
+	case TextClass, BlobClass:
+		i, _ := parseIntegerPrefix(string(v.data))
+		return i
+	}
+	return 0
+}
+
+// Value as a float. (Same conversion as sqlite3_value_double)
+func (v Value) Float64() float64 {
+	switch v.class {
+	case IntegerClass:
+		return float64(v.i64)
+	case RealClass:
+		return v.f64
+	case TextClass, BlobClass:
+		f, _ := parseRealPrefix(string(v.data))
+		return f
+	}
+	return 0
+}
+
+// Value as a text. (Same conversion as sqlite3_value_text); NULL is an empty string.
+func (v Value) Text() string {
+	switch v.class {
+	case IntegerClass:
+		return strconv.FormatInt(v.i64, 10)
+	case RealClass:
+		return FormatReal(v.f64)
+	case TextClass, BlobClass:
+		return string(v.data)
+	}
+	return ""
+}
+
+// Value as raw bytes. (Same conversion as sqlite3_value_blob); NULL is nil.
+func (v Value) Bytes() []byte {
+	switch v.class {
+	case TextClass, BlobClass:
+		return v.data
+	case IntegerClass, RealClass:
+		return []byte(v.Text())
+	}
+	return nil
+}
+
+// Render the value the way sqlite3 shell does in its list mode.
+func (v Value) String() string {
+	return v.Text()
+}
+
+// Render a REAL the same as SQLite's "%!.15g". (i.e. always with a decimal point; 100.0, 1.0e+20)
+func FormatReal(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return ""
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case f == 0:
+		return "0.0"
+	}
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	mantissa, exponent, hasExponent := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if hasExponent {
+		return mantissa + "e" + exponent
+	}
+	return mantissa
+}
+
+// Convert a float to integer the way SQLite does; out of range values are clamped.
+func realToInteger(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f <= math.MinInt64:
+		return math.MinInt64
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return int64(f)
+}
+
+// Parse the longest integer prefix of s (after leading spaces). The bool tells if the whole string was consumed.
+func parseIntegerPrefix(s string) (int64, bool) {
+	t := strings.TrimLeft(s, " \t\n\r")
+	end := 0
+	if end < len(t) && (t[end] == '+' || t[end] == '-') {
+		end++
+	}
+	digits := end
+	for end < len(t) && t[end] >= '0' && t[end] <= '9' {
+		end++
+	}
+	if end == digits {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(t[:end], 10, 64)
+	if err != nil {
+		// overflow; clamp just like SQLite.
+		if t[0] == '-' {
+			return math.MinInt64, false
+		}
+		return math.MaxInt64, false
+	}
+	return i, strings.TrimRight(t[end:], " \t\n\r") == ""
+}
+
+// Parse the longest real number prefix of s (after leading spaces). The bool tells if the whole string was consumed.
+func parseRealPrefix(s string) (float64, bool) {
+	t := strings.TrimLeft(s, " \t\n\r")
+	end := 0
+	if end < len(t) && (t[end] == '+' || t[end] == '-') {
+		end++
+	}
+	digits := 0
+	for end < len(t) && t[end] >= '0' && t[end] <= '9' {
+		end++
+		digits++
+	}
+	if end < len(t) && t[end] == '.' {
+		end++
+		for end < len(t) && t[end] >= '0' && t[end] <= '9' {
+			end++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	if end < len(t) && (t[end] == 'e' || t[end] == 'E') {
+		exp := end + 1
+		if exp < len(t) && (t[exp] == '+' || t[exp] == '-') {
+			exp++
+		}
+		if exp < len(t) && t[exp] >= '0' && t[exp] <= '9' {
+			for exp < len(t) && t[exp] >= '0' && t[exp] <= '9' {
+				exp++
+			}
+			end = exp
+		}
+	}
+	f, _ := strconv.ParseFloat(t[:end], 64)
+	return f, strings.TrimRight(t[end:], " \t\n\r") == ""
+}
@@ -2,8 +2,15 @@ package btree
 
 import "bytes"
 
+// The longest varint is 9 bytes.
+const MaxVarintLen = 9
+
+// Read a SQLite varint (big-endian, 1-9 bytes).
+//
+// The first 8 bytes contribute their lower 7 bits (MSB is the "more" flag). If the 9th byte is reached,
+// all of its 8 bits are used. Hence 8x7 + 8 = 64 bits.
 func ReadVarint(reader *bytes.Reader) (int64, int, error) {
-	var result int64
+	var result uint64
 	var bytesRead int
 
 	for {
@@ -15,10 +22,14 @@ func ReadVarint(reader *bytes.Reader) (int64, int, error) {
 
 		bytesRead++
 
-		result = result << 7 // FIXME: handle last byte?
+		if bytesRead == MaxVarintLen {
+			// The 9th byte supplies all of its 8 bits.
+			result = result<<8 | uint64(b)
+			break
+		}
 
 		// Combine the lower 7 bits into the result
-		result |= int64(b & 0x7F)
+		result = result<<7 | uint64(b&0x7F)
 
 		// Check if the MSB is set; if not, we are done
 		if b&0x80 == 0 {
@@ -26,5 +37,48 @@ func ReadVarint(reader *bytes.Reader) (int64, int, error) {
 		}
 	}
 
-	return result, bytesRead, nil
+	return int64(result), bytesRead, nil
+}
+
+// Number of bytes needed to encode v as a varint.
+func VarintLen(v int64) int {
+	u := uint64(v)
+	if u&(uint64(0xff000000)<<32) != 0 {
+		// 57 bits or more; needs the 9 bytes form.
+		return MaxVarintLen
+	}
+	n := 1
+	for u >>= 7; u != 0; u >>= 7 {
+		n++
+	}
+	return n
+}
+
+// Encode v as a varint into buf (which must be at least VarintLen(v) bytes) and returns the number of bytes written.
+func PutVarint(buf []byte, v int64) int {
+	u := uint64(v)
+	if u&(uint64(0xff000000)<<32) != 0 {
+		// the last byte holds the lowest 8 bits, others hold 7 bits each.
+		buf[8] = byte(u)
+		u >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(u&0x7F) | 0x80
+			u >>= 7
+		}
+		return MaxVarintLen
+	}
+	n := VarintLen(v)
+	for i := n - 1; i >= 0; i-- {
+		buf[i] = byte(u&0x7F) | 0x80
+		u >>= 7
+	}
+	buf[n-1] &= 0x7F // the last byte has no "more" flag.
+	return n
+}
+
+// Append varint encoded v to buf.
+func AppendVarint(buf []byte, v int64) []byte {
+	var tmp [MaxVarintLen]byte
+	n := PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
 }
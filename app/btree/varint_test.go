@@ -0,0 +1,93 @@
+package btree
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestVarintRoundTrip(t *testing.T) {
+	type testCase struct {
+		v    int64
+		size int
+	}
+	var cases []testCase
+	// 2^(7k)-1 is the largest value of k bytes, 2^(7k) the smallest one of k+1 bytes; up to 8 bytes of 7 bits each.
+	for k := 1; k <= 8; k++ {
+		edge := int64(1) << (7 * k)
+		cases = append(cases, testCase{edge - 1, k})
+		next := k + 1
+		if k == 8 {
+			// 57 bits or more, the 9 bytes form.
+			next = MaxVarintLen
+		}
+		cases = append(cases, testCase{edge, next})
+	}
+	cases = append(cases,
+		testCase{0, 1},
+		testCase{1, 1},
+		testCase{math.MaxInt64, MaxVarintLen},
+		testCase{math.MinInt64, MaxVarintLen},
+		testCase{-1, MaxVarintLen},
+		testCase{-128, MaxVarintLen},
+		testCase{1 << 63 >> 1, MaxVarintLen}, // 2^62
+		testCase{-(1 << 56), MaxVarintLen},
+	)
+	for _, c := range cases {
+		if got := VarintLen(c.v); got != c.size {
+			t.Errorf("VarintLen(%d) = %d, want %d", c.v, got, c.size)
+		}
+		buf := make([]byte, MaxVarintLen)
+		n := PutVarint(buf, c.v)
+		if n != c.size {
+			t.Errorf("PutVarint(%d) wrote %d bytes, want %d", c.v, n, c.size)
+		}
+		for i := 0; i < n-1; i++ {
+			if buf[i]&0x80 == 0 {
+				t.Errorf("PutVarint(%d) byte %d has no continuation bit: % x", c.v, i, buf[:n])
+			}
+		}
+		if n < MaxVarintLen && buf[n-1]&0x80 != 0 {
+			t.Errorf("PutVarint(%d) last byte has the continuation bit: % x", c.v, buf[:n])
+		}
+		got, read, err := ReadVarint(bytes.NewReader(buf[:n]))
+		if err != nil {
+			t.Errorf("ReadVarint(% x) failed: %v", buf[:n], err)
+			continue
+		}
+		if got != c.v || read != n {
+			t.Errorf("ReadVarint(% x) = %d (%d bytes), want %d (%d bytes)", buf[:n], got, read, c.v, n)
+		}
+		if appended := AppendVarint([]byte{0xAA}, c.v); !bytes.Equal(appended[1:], buf[:n]) {
+			t.Errorf("AppendVarint(%d) = % x, want % x", c.v, appended[1:], buf[:n])
+		}
+	}
+}
+
+func TestVarintNineBytes(t *testing.T) {
+	// the 9th byte contributes all of its 8 bits.
+	buf := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	got, n, err := ReadVarint(bytes.NewReader(buf))
+	if err != nil || got != -1 || n != MaxVarintLen {
+		t.Errorf("ReadVarint(% x) = %d, %d, %v; want -1, 9", buf, got, n, err)
+	}
+	buf = []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}
+	got, n, err = ReadVarint(bytes.NewReader(buf))
+	if err != nil || got != 0 || n != MaxVarintLen {
+		t.Errorf("ReadVarint(% x) = %d, %d, %v; want 0, 9", buf, got, n, err)
+	}
+	// whatever follows the 9th byte is not part of it.
+	buf = []byte{0xC0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00, 0x7F}
+	got, n, err = ReadVarint(bytes.NewReader(buf))
+	if err != nil || got != math.MinInt64 || n != MaxVarintLen {
+		t.Errorf("ReadVarint(% x) = %d, %d, %v; want %d, 9", buf, got, n, err, int64(math.MinInt64))
+	}
+}
+
+func TestVarintTruncated(t *testing.T) {
+	buf := make([]byte, MaxVarintLen)
+	n := PutVarint(buf, 1<<20)
+	if _, _, err := ReadVarint(bytes.NewReader(buf[:n-1])); err == nil {
+		t.Errorf("ReadVarint of a truncated varint succeeded")
+	}
+}
@@ -4,109 +4,171 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 
-	"github.com/rqlite/sql"
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/sqlite"
 )
 
 // Usage: your_sqlite3.sh sample.db .dbinfo
+//
+// Several commands run in order against the same connection, e.g.
+//
+//	your_sqlite3.sh sample.db "PRAGMA cache_size = 100" "SELECT count(*) FROM apples" .stats
 func main() {
 	databaseFilePath := os.Args[1]
-	command := os.Args[2]
+	commands := os.Args[2:]
 
-	db, err := NewDb(databaseFilePath)
+	sqlite.DebugOutput = os.Stderr
+	db, err := sqlite.NewDb(databaseFilePath)
 	if err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
+	defer db.Close()
 
+	for _, command := range commands {
+		if err := run(db, command); err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+	}
+}
+
+func run(db *sqlite.Db, command string) error {
 	switch command {
 	case ".tables":
-		tableNames := make([]string, 0)
-		for _, tbl := range db.tables {
-			tableNames = append(tableNames, tbl.Name())
+		// tables and views, but not the internal ones. (e.g. sqlite_sequence)
+		names := make([]string, 0)
+		for _, tbl := range db.Tables() {
+			names = append(names, tbl.Name())
+		}
+		for _, view := range db.Views() {
+			names = append(names, view.Name())
 		}
-		sort.Strings(tableNames)
-		fmt.Printf("%s", strings.Join(tableNames, " "))
+		names = slices.DeleteFunc(names, func(name string) bool {
+			return strings.HasPrefix(strings.ToLower(name), "sqlite_")
+		})
+		sort.Strings(names)
+		printColumns(names)
 	case ".dbinfo":
-		fmt.Printf("database page size: %d\n", db.pageSize)
-
-		tableCount := len(db.tables)
-		fmt.Printf("number of tables: %d\n", tableCount)
+		// Same layout as sqlite3's .dbinfo
+		h := db.Header()
+		fmt.Printf("%-20s %d\n", "database page size:", h.PageSize)
+		fmt.Printf("%-20s %d\n", "write format:", h.WriteVersion)
+		fmt.Printf("%-20s %d\n", "read format:", h.ReadVersion)
+		fmt.Printf("%-20s %d\n", "reserved bytes:", h.ReservedBytes)
+		fmt.Printf("%-20s %d\n", "file change counter:", h.FileChangeCounter)
+		fmt.Printf("%-20s %d\n", "database page count:", h.DatabaseSizeInPages)
+		fmt.Printf("%-20s %d\n", "freelist page count:", h.FreelistPageCount)
+		fmt.Printf("%-20s %d\n", "schema cookie:", h.SchemaCookie)
+		fmt.Printf("%-20s %d\n", "schema format:", h.SchemaFormat)
+		fmt.Printf("%-20s %d\n", "default cache size:", h.DefaultCacheSize)
+		fmt.Printf("%-20s %d\n", "autovacuum top root:", h.AutovacuumTopRoot)
+		fmt.Printf("%-20s %d\n", "incremental vacuum:", h.IncrementalVacuum)
+		switch h.TextEncoding {
+		case sqlite.UTF8, sqlite.UTF16le, sqlite.UTF16be:
+			fmt.Printf("%-20s %d (%s)\n", "text encoding:", h.TextEncoding, h.TextEncoding)
+		default:
+			fmt.Printf("%-20s %d\n", "text encoding:", h.TextEncoding)
+		}
+		fmt.Printf("%-20s %d\n", "user version:", h.UserVersion)
+		fmt.Printf("%-20s %d\n", "application id:", h.ApplicationID)
+		fmt.Printf("%-20s %d\n", "software version:", h.SQLiteVersionNumber)
+		fmt.Printf("%-20s %d\n", "number of tables:", db.CountSchemas(sqlite.Table))
+		fmt.Printf("%-20s %d\n", "number of indexes:", db.CountSchemas(sqlite.Index))
+		fmt.Printf("%-20s %d\n", "number of triggers:", db.CountSchemas(sqlite.Trigger))
+		fmt.Printf("%-20s %d\n", "number of views:", db.CountSchemas(sqlite.View))
+		fmt.Printf("%-20s %d\n", "schema size:", db.SchemaSize())
+		fmt.Printf("%-20s %d\n", "data version", 1) // a fresh read-only connection never sees a change.
+	case ".stats":
+		stats := db.CacheStats()
+		fmt.Printf("%-20s %d\n", "cache size:", db.CacheSize())
+		fmt.Printf("%-20s %d of %d\n", "pages cached:", stats.Pages, stats.Capacity)
+		fmt.Printf("%-20s %d\n", "cache hits:", stats.Hits)
+		fmt.Printf("%-20s %d\n", "cache misses:", stats.Misses)
+		fmt.Printf("%-20s %d\n", "cache evictions:", stats.Evictions)
 
 	default:
 		// QUERY!
-		_sql := command
-		// Eval sql
-		stmt, err := sql.NewParser(strings.NewReader(_sql)).ParseStatement()
+		rows, err := db.Query(command)
 		if err != nil {
-			log.Fatal(err)
-			os.Exit(1)
+			return err
+		}
+		defer rows.Close()
+		if rows.IsQueryPlan() {
+			return printQueryPlan(rows)
 		}
-		switch stmt.(type) {
-		case *sql.SelectStatement:
-			selectStmt := stmt.(*sql.SelectStatement)
-			// perform the select
-			tableName := strings.Trim(selectStmt.Source.String(), "\"")
-			tbl, ok := db.tables[tableName]
-			if !ok {
-				log.Fatal(fmt.Sprintf("unknown table %s", tableName))
-				os.Exit(1)
+		for rows.Next() {
+			// Print output
+			for v, value := range rows.Values() {
+				if v != 0 {
+					fmt.Print("|")
+				}
+				fmt.Print(value.String())
 			}
+			fmt.Println()
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			colNames := make([]string, len(selectStmt.Columns))
-			for c, column := range selectStmt.Columns {
-				col := strings.ToLower(strings.Trim(column.String(), "\""))
-				colNames[c] = col
-			}
-			where := map[string]string{}
-			// apply simple condition here
-			if selectStmt.WhereExpr != nil {
-				whereClause := strings.SplitN(selectStmt.WhereExpr.String(), "=", 2)
-				key := strings.Trim(whereClause[0], "\" ")
-				where[key] = strings.Trim(whereClause[1], "' ")
+// Print the names in columns down the page, as wide as the longest name and fitting 80 characters, like sqlite3 does.
+func printColumns(names []string) {
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	columns := max(80/(width+2), 1)
+	rows := (len(names) + columns - 1) / columns
+	for r := 0; r < rows; r++ {
+		for n := r; n < len(names); n += rows {
+			if n >= rows {
+				fmt.Print("  ")
 			}
-			eligibleIndex, matchedPrefix := tbl.eligibleIndex(&where)
+			fmt.Printf("%-*s", width, names[n])
+		}
+		fmt.Println()
+	}
+}
 
-			if len(colNames) == 1 && colNames[0] == "count(*)" {
-				// apply simple condition here
-				// Read values from all cells per such column index
-				count := 0
-				if eligibleIndex != nil {
-					count = len(eligibleIndex.IndexScan(&where, matchedPrefix))
-				} else {
-					count = len(tbl.rows(where, nil, ""))
-				}
-				fmt.Printf("%d\n", count)
+// Print EXPLAIN QUERY PLAN as a tree, like sqlite3 does.
+func printQueryPlan(rows *sqlite.Rows) error {
+	type step struct {
+		id, parent int64
+		detail     string
+	}
+	var steps []step
+	for rows.Next() {
+		values := rows.Values()
+		steps = append(steps, step{values[0].Integer(), values[1].Integer(), values[3].Text()})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	fmt.Println("QUERY PLAN")
+	var printChildren func(parent int64, prefix string)
+	printChildren = func(parent int64, prefix string) {
+		var children []step
+		for _, s := range steps {
+			if s.parent == parent {
+				children = append(children, s)
+			}
+		}
+		for c, child := range children {
+			if c == len(children)-1 {
+				fmt.Printf("%s`--%s\n", prefix, child.detail)
+				printChildren(child.id, prefix+"   ")
 			} else {
-				// Find where is the name of that particular table.
-				pending := len(colNames)
-				colIndices := make([]int, pending)
-				for j, cn := range colNames {
-					// fmt.Printf("Scanning for %s through %s %v\n", cn, col.Name.Name, colIndices)
-					colIndices[j], ok = tbl.colIndexMap[cn]
-					if !ok {
-						log.Fatal(fmt.Sprintf("Unknown column %s to select", cn))
-						os.Exit(1)
-					}
-				}
-
-				// Read values from all cells per such column index
-				for _, row := range tbl.rows(where, eligibleIndex, matchedPrefix) {
-					// Print output
-					for v, ci := range colIndices {
-						if v != 0 {
-							fmt.Print("|")
-						}
-						fmt.Printf("%s", row.Column(ci))
-					}
-					fmt.Println()
-				}
+				fmt.Printf("%s|--%s\n", prefix, child.detail)
+				printChildren(child.id, prefix+"|  ")
 			}
-		default:
-			log.Fatal(fmt.Sprintf("'%s' statement is not yet supported.", _sql))
-			os.Exit(1)
 		}
 	}
+	printChildren(0, "")
+	return nil
 }
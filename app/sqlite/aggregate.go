@@ -0,0 +1,378 @@
+package sqlite
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// Whether the name is an aggregate function, with any number of arguments.
+func isAggregateName(name string) bool {
+	switch strings.ToLower(name) {
+	case "count", "sum", "total", "avg", "min", "max", "group_concat":
+		return true
+	}
+	return false
+}
+
+// Running state of one aggregate function within one group.
+type aggregator interface {
+	// Feed the arguments of a row. Returns true when the row holds the new min/max. (see aggregateSet.minMax)
+	step(args []btree.Value) (bool, error)
+	final() btree.Value
+}
+
+// Aggregate functions by name, given the number of arguments. nil when it is not an aggregate.
+func aggregateFactory(name string, argc int, star bool) func() aggregator {
+	switch strings.ToLower(name) {
+	case "count":
+		if star || argc == 0 {
+			return func() aggregator { return &countAgg{star: true} }
+		}
+		if argc == 1 {
+			return func() aggregator { return &countAgg{} }
+		}
+	case "sum":
+		if argc == 1 {
+			return func() aggregator { return &sumAgg{} }
+		}
+	case "total":
+		if argc == 1 {
+			return func() aggregator { return &sumAgg{total: true} }
+		}
+	case "avg":
+		if argc == 1 {
+			return func() aggregator { return &sumAgg{average: true} }
+		}
+	case "min":
+		// min()/max() with more than one argument are the scalar functions.
+		if argc == 1 {
+			return func() aggregator { return &minMaxAgg{sign: -1} }
+		}
+	case "max":
+		if argc == 1 {
+			return func() aggregator { return &minMaxAgg{sign: 1} }
+		}
+	case "group_concat":
+		if argc == 1 || argc == 2 {
+			return func() aggregator { return &groupConcatAgg{} }
+		}
+	}
+	return nil
+}
+
+// count(*) counts rows, count(x) counts non-NULL x.
+type countAgg struct {
+	star  bool
+	count int64
+}
+
+func (a *countAgg) step(args []btree.Value) (bool, error) {
+	if a.star || !args[0].IsNull() {
+		a.count++
+	}
+	return false, nil
+}
+
+func (a *countAgg) final() btree.Value {
+	return btree.IntegerValue(a.count)
+}
+
+// sum(x), total(x) and avg(x). sum stays an integer until a real shows up; total and avg are always real.
+type sumAgg struct {
+	total    bool
+	average  bool
+	count    int64
+	isReal   bool
+	i64      int64
+	f64      float64
+	overflow bool
+}
+
+func (a *sumAgg) step(args []btree.Value) (bool, error) {
+	v := args[0]
+	if v.IsNull() {
+		return false, nil
+	}
+	a.count++
+	// integers and text that is an integer (e.g. '3') add up as integers, anything else (e.g. 2.0, '3.0' or 'abc')
+	// makes the sum a real.
+	isInteger := v.Class() == btree.IntegerClass
+	if v.Class() == btree.TextClass && v.ApplyAffinity(btree.NumericAffinity).Class() != btree.TextClass {
+		isInteger = v.Numeric().Class() == btree.IntegerClass
+	}
+	if n := v.Numeric(); isInteger && !a.isReal {
+		s := a.i64 + n.Integer()
+		if (n.Integer() > 0 && s < a.i64) || (n.Integer() < 0 && s > a.i64) {
+			a.overflow = true
+		}
+		a.i64 = s
+		a.f64 += float64(n.Integer())
+	} else {
+		a.isReal = true
+		a.f64 += v.Numeric().Float64()
+	}
+	if a.overflow && !a.isReal && !a.total && !a.average {
+		return false, fmt.Errorf("integer overflow")
+	}
+	return false, nil
+}
+
+func (a *sumAgg) final() btree.Value {
+	switch {
+	case a.total:
+		return btree.RealValue(a.f64)
+	case a.count == 0:
+		return btree.NullValue()
+	case a.average:
+		return btree.RealValue(a.f64 / float64(a.count))
+	case a.isReal:
+		return btree.RealValue(a.f64)
+	}
+	return btree.IntegerValue(a.i64)
+}
+
+// min(x) (sign -1) and max(x) (sign 1), NULLs are ignored. TEXT compares by the collation of x.
+type minMaxAgg struct {
+	sign      int
+	collation string
+	found     bool
+	best      btree.Value
+}
+
+func (a *minMaxAgg) step(args []btree.Value) (bool, error) {
+	v := args[0]
+	if v.IsNull() {
+		return false, nil
+	}
+	if !a.found || btree.CompareCollated(v, a.best, a.collation)*a.sign > 0 {
+		a.found = true
+		a.best = v
+		return true, nil
+	}
+	return false, nil
+}
+
+func (a *minMaxAgg) final() btree.Value {
+	if !a.found {
+		return btree.NullValue()
+	}
+	return a.best
+}
+
+// group_concat(x [, separator]) joins non-NULL x, separated by "," by default.
+type groupConcatAgg struct {
+	found bool
+	text  strings.Builder
+}
+
+func (a *groupConcatAgg) step(args []btree.Value) (bool, error) {
+	if args[0].IsNull() {
+		return false, nil
+	}
+	if a.found {
+		if len(args) > 1 {
+			a.text.WriteString(args[1].Text())
+		} else {
+			a.text.WriteString(",")
+		}
+	}
+	a.found = true
+	a.text.WriteString(args[0].Text())
+	return false, nil
+}
+
+func (a *groupConcatAgg) final() btree.Value {
+	if !a.found {
+		return btree.NullValue()
+	}
+	return btree.TextValue(a.text.String())
+}
+
+// Only feed arguments that were not seen before, by the collation of the argument. (e.g. count(DISTINCT x))
+type distinctAgg struct {
+	aggregator
+	collations []string // of the argument
+	seen       map[string]bool
+}
+
+func (a *distinctAgg) step(args []btree.Value) (bool, error) {
+	key := valuesKey(args[:1], a.collations)
+	if args[0].IsNull() || a.seen[key] {
+		return false, nil
+	}
+	a.seen[key] = true
+	return a.aggregator.step(args)
+}
+
+// A key under which equal values (as in `=`, e.g. 1 and 1.0) are the same. TEXT compares by the collation
+// at the same index. (e.g. 'a' and 'A' are the same by NOCASE)
+func valuesKey(values []btree.Value, collations []string) string {
+	normalized := make([]btree.Value, len(values))
+	for i, v := range values {
+		if v.Class() == btree.RealClass && v.Float64() == math.Trunc(v.Float64()) && math.Abs(v.Float64()) < 9e18 {
+			v = btree.IntegerValue(int64(v.Float64()))
+		}
+		normalized[i] = btree.CollationKey(v, collations[i])
+	}
+	return string(btree.EncodeRecord(normalized))
+}
+
+// An aggregate function call found while compiling the query.
+type aggregateCall struct {
+	name    string
+	newAgg  func() aggregator
+	args    []evaluator
+	filter  evaluator // FILTER (WHERE ..), may be nil
+	isMinOr bool      // min() or max(); bare columns come from the row it picked.
+}
+
+// Aggregate calls of a query. Expressions read the result of call i from evalEnv.aggregates[i].
+type aggregateSet struct {
+	calls   []*aggregateCall
+	sources int // number of tables in FROM.
+}
+
+// Register the aggregate call and return an evaluator reading its result.
+// Arguments are compiled against `rowScope`, where aggregates are not allowed.
+func (s *aggregateSet) add(call *sql.Call, factory func() aggregator, rowScope *scope) (evaluator, error) {
+	if call.Over != nil {
+		return nil, fmt.Errorf("window functions are not yet supported")
+	}
+	agg := &aggregateCall{name: strings.ToLower(call.Name.Name), newAgg: factory}
+	agg.isMinOr = (agg.name == "min" || agg.name == "max")
+	for _, arg := range call.Args {
+		ev, _, err := compileExpr(arg, rowScope)
+		if err != nil {
+			return nil, err
+		}
+		agg.args = append(agg.args, ev)
+	}
+	if agg.isMinOr {
+		newAgg := agg.newAgg
+		collation, _ := exprCollation(call.Args[0], rowScope)
+		agg.newAgg = func() aggregator {
+			a := newAgg().(*minMaxAgg)
+			a.collation = collation
+			return a
+		}
+	}
+	if call.Distinct.IsValid() {
+		if len(call.Args) != 1 {
+			return nil, fmt.Errorf("DISTINCT aggregates must have exactly one argument")
+		}
+		newAgg := agg.newAgg
+		collation, _ := exprCollation(call.Args[0], rowScope)
+		agg.newAgg = func() aggregator {
+			return &distinctAgg{aggregator: newAgg(), collations: []string{collation}, seen: map[string]bool{}}
+		}
+	}
+	if call.Filter != nil {
+		ev, _, err := compileExpr(call.Filter.X, rowScope)
+		if err != nil {
+			return nil, err
+		}
+		agg.filter = ev
+	}
+	slot := len(s.calls)
+	s.calls = append(s.calls, agg)
+	return func(env *evalEnv) (btree.Value, error) {
+		return env.aggregates[slot], nil
+	}, nil
+}
+
+// Index of the call whose min/max row provides the bare columns, -1 for none (the first row of the group is used).
+func (s *aggregateSet) minMax() int {
+	last := -1
+	for i, call := range s.calls {
+		if call.isMinOr {
+			last = i
+		}
+	}
+	return last
+}
+
+// State of one group.
+type groupState struct {
+	key         []btree.Value
+	aggregators []aggregator
+	rows        []Row // provide the bare columns, a row per table. (columns outside of aggregates)
+	hasRow      bool
+}
+
+func (s *aggregateSet) newGroup(key []btree.Value) *groupState {
+	// until the first row arrives, bare columns are NULL.
+	g := &groupState{key: key, aggregators: make([]aggregator, len(s.calls)), rows: make([]Row, s.sources)}
+	for i, call := range s.calls {
+		g.aggregators[i] = call.newAgg()
+	}
+	return g
+}
+
+// Feed a row (of each table) into the group.
+func (s *aggregateSet) step(g *groupState, rows []Row, minMax int) error {
+	env := &evalEnv{rows: rows}
+	if !g.hasRow {
+		copy(g.rows, rows)
+		g.hasRow = true
+	}
+	args := make([]btree.Value, 0, 2)
+	for i, call := range s.calls {
+		if call.filter != nil {
+			v, err := call.filter(env)
+			if err != nil {
+				return err
+			}
+			if isTrue, _ := truth(v); !isTrue {
+				continue
+			}
+		}
+		args = args[:0]
+		for _, arg := range call.args {
+			v, err := arg(env)
+			if err != nil {
+				return err
+			}
+			args = append(args, v)
+		}
+		picked, err := g.aggregators[i].step(args)
+		if err != nil {
+			return err
+		}
+		if picked && i == minMax {
+			copy(g.rows, rows)
+		}
+	}
+	return nil
+}
+
+// What the result columns, HAVING and ORDER BY of an aggregate query are evaluated against.
+func (g *groupState) env() *evalEnv {
+	results := make([]btree.Value, len(g.aggregators))
+	for i, agg := range g.aggregators {
+		results[i] = agg.final()
+	}
+	return &evalEnv{rows: g.rows, aggregates: results}
+}
+
+// Whether the expression calls an aggregate function.
+func hasAggregate(expr sql.Expr) bool {
+	if expr == nil {
+		return false
+	}
+	found := false
+	sql.Walk(sql.VisitFunc(func(node sql.Node) error {
+		if call, ok := node.(*sql.Call); ok && isAggregateName(call.Name.Name) {
+			// min(a, b) is the scalar function.
+			name := strings.ToLower(call.Name.Name)
+			if !((name == "min" || name == "max") && len(call.Args) > 1) {
+				found = true
+			}
+		}
+		return nil
+	}), expr)
+	return found
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// sum() is an integer only when every value is one (or text that is one), total() and avg() are always real.
+// The results are sqlite3's `quote(f(x))` over the rows of x.
+func TestSumAggregates(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []string // SQL literals, a row each
+		want   string
+	}{
+		{"sum", []string{"1", "2"}, "3"},
+		{"sum", []string{"2.0", "2.0"}, "4.0"},
+		{"sum", []string{"1", "2.5"}, "3.5"},
+		{"sum", []string{"2.5", "1"}, "3.5"},
+		{"sum", []string{"'3'", "1"}, "4"},
+		{"sum", []string{"' 4 '"}, "4"},
+		{"sum", []string{"'3.0'"}, "3.0"},
+		{"sum", []string{"'1e2'"}, "100.0"},
+		{"sum", []string{"'3abc'"}, "3.0"},
+		{"sum", []string{"'abc'"}, "0.0"},
+		{"sum", []string{"x'33'"}, "3.0"},
+		{"sum", []string{"NULL", "1"}, "1"},
+		{"sum", []string{"NULL"}, "NULL"},
+		{"sum", []string{}, "NULL"},
+		{"total", []string{"2"}, "2.0"},
+		{"total", []string{}, "0.0"},
+		{"avg", []string{"2.0", "4"}, "3.0"},
+		{"avg", []string{"NULL"}, "NULL"},
+	}
+	for _, c := range cases {
+		agg := aggregateFactory(c.name, 1, false)()
+		for _, literal := range c.values {
+			if _, err := agg.step([]btree.Value{literalValue(t, literal)}); err != nil {
+				t.Fatalf("%s(%v) failed: %v", c.name, c.values, err)
+			}
+		}
+		if got := quoteValue(agg.final()); got != c.want {
+			t.Errorf("%s(%v) = %s, want %s", c.name, c.values, got, c.want)
+		}
+	}
+}
+
+func TestSumOverflow(t *testing.T) {
+	agg := aggregateFactory("sum", 1, false)()
+	if _, err := agg.step([]btree.Value{btree.IntegerValue(9223372036854775807)}); err != nil {
+		t.Fatalf("sum failed: %v", err)
+	}
+	if _, err := agg.step([]btree.Value{btree.IntegerValue(1)}); err == nil {
+		t.Errorf("sum past the largest integer did not fail")
+	}
+	agg = aggregateFactory("total", 1, false)()
+	for i := 0; i < 2; i++ {
+		if _, err := agg.step([]btree.Value{btree.IntegerValue(9223372036854775807)}); err != nil {
+			t.Fatalf("total failed: %v", err)
+		}
+	}
+}
+
+// DISTINCT and min()/max() compare TEXT by the collation of the argument.
+func TestAggregateCollation(t *testing.T) {
+	values := []string{"'b'", "'A'", "'a'", "'B '", "NULL", "1", "1.0"}
+	cases := []struct {
+		name      string
+		collation string
+		distinct  bool
+		want      string
+	}{
+		{"count", "BINARY", true, "5"},
+		{"count", "NOCASE", true, "4"},
+		{"count", "RTRIM", true, "5"},
+		{"group_concat", "NOCASE", true, "'b,A,B ,1'"},
+		{"max", "BINARY", false, "'b'"},
+		{"max", "NOCASE", false, "'B '"},
+		{"min", "NOCASE", false, "1"},
+	}
+	for _, c := range cases {
+		var agg aggregator
+		if c.distinct {
+			agg = &distinctAgg{aggregator: aggregateFactory(c.name, 1, false)(), collations: []string{c.collation}, seen: map[string]bool{}}
+		} else {
+			m := aggregateFactory(c.name, 1, false)().(*minMaxAgg)
+			m.collation = c.collation
+			agg = m
+		}
+		for _, literal := range values {
+			if _, err := agg.step([]btree.Value{literalValue(t, literal)}); err != nil {
+				t.Fatalf("%s failed: %v", c.name, err)
+			}
+		}
+		if got := quoteValue(agg.final()); got != c.want {
+			t.Errorf("%s (%s) = %s, want %s", c.name, c.collation, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,636 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// CREATE TABLE as stored in sqlite_schema. rqlite/sql only knows a few (upper case, single word) type names,
+// so these statements are scanned here. See https://www.sqlite.org/lang_createtable.html
+type TableSpec struct {
+	Name         string
+	Columns      []ColumnSpec
+	Constraints  []Constraint // table constraints. e.g. PRIMARY KEY (a, b)
+	WithoutRowid bool
+	Strict       bool
+}
+
+// A column definition.
+type ColumnSpec struct {
+	Name        string
+	Type        string // declared type as written (e.g. "VARCHAR(10)"), empty when there is none.
+	Affinity    btree.Affinity
+	Constraints []Constraint
+}
+
+type ConstraintKind int8
+
+const (
+	PrimaryKeyConstraint ConstraintKind = iota
+	NotNullConstraint
+	NullConstraint // `NULL`, allowed for symmetry with NOT NULL; it does nothing.
+	UniqueConstraint
+	CheckConstraint
+	DefaultConstraint
+	CollateConstraint
+	ForeignKeyConstraint
+	GeneratedConstraint
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case PrimaryKeyConstraint:
+		return "PRIMARY KEY"
+	case NotNullConstraint:
+		return "NOT NULL"
+	case NullConstraint:
+		return "NULL"
+	case UniqueConstraint:
+		return "UNIQUE"
+	case CheckConstraint:
+		return "CHECK"
+	case DefaultConstraint:
+		return "DEFAULT"
+	case CollateConstraint:
+		return "COLLATE"
+	case ForeignKeyConstraint:
+		return "FOREIGN KEY"
+	case GeneratedConstraint:
+		return "GENERATED"
+	}
+	return "unknown"
+}
+
+// A column or table constraint. Only the fields of its kind are set.
+type Constraint struct {
+	Kind ConstraintKind
+	Name string // CONSTRAINT name, empty when not named.
+	SQL  string // as written, without the name. e.g. "PRIMARY KEY AUTOINCREMENT"
+
+	Columns       []IndexedColumn // PRIMARY KEY, UNIQUE and FOREIGN KEY of a table constraint.
+	Desc          bool            // PRIMARY KEY DESC of a column.
+	Autoincrement bool
+	OnConflict    string // e.g. "REPLACE", empty for the default (ABORT)
+	Collation     string // COLLATE
+	Expr          string // CHECK, DEFAULT and GENERATED; the expression as written.
+	Stored        bool   // GENERATED ... STORED, rather than VIRTUAL.
+
+	ForeignTable   string // REFERENCES
+	ForeignColumns []string
+}
+
+// A column of a PRIMARY KEY, UNIQUE or FOREIGN KEY table constraint.
+type IndexedColumn struct {
+	Name      string
+	Collation string // empty when not given.
+	Desc      bool
+}
+
+func (c Constraint) String() string {
+	if c.Name != "" {
+		return "CONSTRAINT " + c.Name + " " + c.SQL
+	}
+	return c.SQL
+}
+
+// The first constraint of that kind, nil if none.
+func (c *ColumnSpec) Constraint(kind ConstraintKind) *Constraint {
+	for i := range c.Constraints {
+		if c.Constraints[i].Kind == kind {
+			return &c.Constraints[i]
+		}
+	}
+	return nil
+}
+
+// The statement is something else than CREATE TABLE.
+var errNotCreateTable = errors.New("not a CREATE TABLE statement")
+
+// Parse a CREATE TABLE statement.
+func ParseCreateTable(sqlText string) (*TableSpec, error) {
+	p := newSpecParser(sqlText)
+	if !p.accept("CREATE") {
+		return nil, errNotCreateTable
+	}
+	if !p.accept("TEMP") {
+		p.accept("TEMPORARY")
+	}
+	if !p.accept("TABLE") {
+		return nil, errNotCreateTable
+	}
+	p.accept("IF", "NOT", "EXISTS")
+	spec := &TableSpec{}
+	var err error
+	if spec.Name, err = p.identifier("table name"); err != nil {
+		return nil, err
+	}
+	if p.accept(".") {
+		// schema name. e.g. main.t
+		if spec.Name, err = p.identifier("table name"); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().is("AS") {
+		return nil, fmt.Errorf("CREATE TABLE ... AS SELECT is not supported")
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		if isTableConstraintStart(p.peek()) {
+			// the table constraints come last; commas between them are optional.
+			for isTableConstraintStart(p.peek()) {
+				constraint, err := p.tableConstraint()
+				if err != nil {
+					return nil, err
+				}
+				spec.Constraints = append(spec.Constraints, constraint)
+				p.accept(",")
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+		column, err := p.columnDefinition()
+		if err != nil {
+			return nil, err
+		}
+		spec.Columns = append(spec.Columns, column)
+		if p.accept(")") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+
+	// table options.
+	for !p.done() && !p.peek().is(";") {
+		switch {
+		case p.accept("WITHOUT", "ROWID"):
+			spec.WithoutRowid = true
+		case p.accept("STRICT"):
+			spec.Strict = true
+		default:
+			return nil, p.syntaxError()
+		}
+		p.accept(",")
+	}
+	p.accept(";")
+	if !p.done() {
+		return nil, p.syntaxError()
+	}
+	if len(spec.Columns) == 0 {
+		return nil, fmt.Errorf("table %s has no columns", spec.Name)
+	}
+	return spec, nil
+}
+
+func (p *specParser) columnDefinition() (ColumnSpec, error) {
+	var column ColumnSpec
+	var err error
+	if column.Name, err = p.identifier("column name"); err != nil {
+		return column, err
+	}
+
+	// the type name is every word up to the first constraint, e.g. "UNSIGNED BIG INT", and maybe "(10, 2)".
+	typeStart := p.at
+	for tok := p.peek(); tok.isName() && !isColumnConstraintStart(tok); tok = p.peek() {
+		p.next()
+	}
+	if p.at > typeStart && p.peek().is("(") {
+		if _, err := p.parenthesized(); err != nil {
+			return column, err
+		}
+	}
+	column.Type = p.textSince(typeStart)
+	column.Affinity = btree.AffinityOf(column.Type)
+
+	for isColumnConstraintStart(p.peek()) {
+		constraint, err := p.columnConstraint()
+		if err != nil {
+			return column, err
+		}
+		column.Constraints = append(column.Constraints, constraint)
+	}
+	return column, nil
+}
+
+func (p *specParser) columnConstraint() (Constraint, error) {
+	var c Constraint
+	if err := p.constraintName(&c); err != nil {
+		return c, err
+	}
+	start := p.at
+	var err error
+	switch tok := p.next(); {
+	case tok.is("PRIMARY"):
+		c.Kind = PrimaryKeyConstraint
+		if err := p.expect("KEY"); err != nil {
+			return c, err
+		}
+		if p.accept("DESC") {
+			c.Desc = true
+		} else {
+			p.accept("ASC")
+		}
+		c.OnConflict = p.conflictClause()
+		c.Autoincrement = p.accept("AUTOINCREMENT")
+	case tok.is("NOT"):
+		c.Kind = NotNullConstraint
+		if err := p.expect("NULL"); err != nil {
+			return c, err
+		}
+		c.OnConflict = p.conflictClause()
+	case tok.is("NULL"):
+		c.Kind = NullConstraint
+		c.OnConflict = p.conflictClause()
+	case tok.is("UNIQUE"):
+		c.Kind = UniqueConstraint
+		c.OnConflict = p.conflictClause()
+	case tok.is("CHECK"):
+		c.Kind = CheckConstraint
+		c.Expr, err = p.parenthesized()
+	case tok.is("DEFAULT"):
+		c.Kind = DefaultConstraint
+		c.Expr, err = p.defaultValue()
+	case tok.is("COLLATE"):
+		c.Kind = CollateConstraint
+		c.Collation, err = p.identifier("collation name")
+	case tok.is("REFERENCES"):
+		c.Kind = ForeignKeyConstraint
+		p.at--
+		err = p.foreignKeyClause(&c)
+	case tok.is("GENERATED"), tok.is("AS"):
+		c.Kind = GeneratedConstraint
+		if tok.is("GENERATED") {
+			if err := p.expect("ALWAYS", "AS"); err != nil {
+				return c, err
+			}
+		}
+		if c.Expr, err = p.parenthesized(); err != nil {
+			return c, err
+		}
+		if p.accept("STORED") {
+			c.Stored = true
+		} else {
+			p.accept("VIRTUAL")
+		}
+	}
+	c.SQL = p.textSince(start)
+	return c, err
+}
+
+func (p *specParser) tableConstraint() (Constraint, error) {
+	var c Constraint
+	if err := p.constraintName(&c); err != nil {
+		return c, err
+	}
+	start := p.at
+	var err error
+	switch tok := p.next(); {
+	case tok.is("PRIMARY"), tok.is("UNIQUE"):
+		c.Kind = UniqueConstraint
+		if tok.is("PRIMARY") {
+			c.Kind = PrimaryKeyConstraint
+			if err := p.expect("KEY"); err != nil {
+				return c, err
+			}
+		}
+		if c.Columns, err = p.indexedColumns(); err != nil {
+			return c, err
+		}
+		c.OnConflict = p.conflictClause()
+	case tok.is("CHECK"):
+		c.Kind = CheckConstraint
+		c.Expr, err = p.parenthesized()
+	case tok.is("FOREIGN"):
+		c.Kind = ForeignKeyConstraint
+		if err := p.expect("KEY"); err != nil {
+			return c, err
+		}
+		if c.Columns, err = p.indexedColumns(); err != nil {
+			return c, err
+		}
+		err = p.foreignKeyClause(&c)
+	}
+	c.SQL = p.textSince(start)
+	return c, err
+}
+
+// CONSTRAINT name, if any.
+func (p *specParser) constraintName(c *Constraint) error {
+	if !p.accept("CONSTRAINT") {
+		return nil
+	}
+	var err error
+	c.Name, err = p.identifier("constraint name")
+	return err
+}
+
+// ON CONFLICT ROLLBACK/ABORT/FAIL/IGNORE/REPLACE, the resolution upper cased; empty when there is none.
+func (p *specParser) conflictClause() string {
+	if !p.accept("ON", "CONFLICT") {
+		return ""
+	}
+	return strings.ToUpper(p.next().text)
+}
+
+// The value of DEFAULT: a literal, a signed number or an expression in parentheses.
+func (p *specParser) defaultValue() (string, error) {
+	if p.peek().is("(") {
+		return p.parenthesized()
+	}
+	start := p.at
+	if p.peek().is("+") || p.peek().is("-") {
+		p.next()
+	}
+	if tok := p.next(); tok.text == "" || tok.is(",") || tok.is(")") {
+		p.at--
+		return "", p.syntaxError()
+	}
+	return p.textSince(start), nil
+}
+
+// REFERENCES table [(columns)] followed by its actions. e.g. ON DELETE CASCADE, DEFERRABLE INITIALLY DEFERRED
+func (p *specParser) foreignKeyClause(c *Constraint) error {
+	if err := p.expect("REFERENCES"); err != nil {
+		return err
+	}
+	var err error
+	if c.ForeignTable, err = p.identifier("table name"); err != nil {
+		return err
+	}
+	if p.peek().is("(") {
+		columns, err := p.indexedColumns()
+		if err != nil {
+			return err
+		}
+		for _, col := range columns {
+			c.ForeignColumns = append(c.ForeignColumns, col.Name)
+		}
+	}
+	for {
+		switch {
+		case p.accept("ON"):
+			if !p.accept("DELETE") && !p.accept("UPDATE") {
+				return p.syntaxError()
+			}
+			if !p.accept("SET", "NULL") && !p.accept("SET", "DEFAULT") && !p.accept("CASCADE") &&
+				!p.accept("RESTRICT") && !p.accept("NO", "ACTION") {
+				return p.syntaxError()
+			}
+		case p.accept("MATCH"):
+			if _, err := p.identifier("match name"); err != nil {
+				return err
+			}
+		case p.peek().is("NOT") && p.peekAt(1).is("DEFERRABLE"), p.peek().is("DEFERRABLE"):
+			p.accept("NOT")
+			p.next()
+			if p.accept("INITIALLY") && !p.accept("DEFERRED") && !p.accept("IMMEDIATE") {
+				return p.syntaxError()
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// (name [COLLATE collation] [ASC|DESC], ...)
+func (p *specParser) indexedColumns() ([]IndexedColumn, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var columns []IndexedColumn
+	for {
+		var col IndexedColumn
+		var err error
+		if col.Name, err = p.identifier("column name"); err != nil {
+			return nil, err
+		}
+		if p.accept("COLLATE") {
+			if col.Collation, err = p.identifier("collation name"); err != nil {
+				return nil, err
+			}
+		}
+		if p.accept("DESC") {
+			col.Desc = true
+		} else {
+			p.accept("ASC")
+		}
+		columns = append(columns, col)
+		if p.accept(")") {
+			return columns, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Words starting a column constraint, ending the type name.
+var columnConstraintStarts = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+func isColumnConstraintStart(tok specToken) bool {
+	for _, keyword := range columnConstraintStarts {
+		if tok.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTableConstraintStart(tok specToken) bool {
+	return tok.is("CONSTRAINT") || tok.is("PRIMARY") || tok.is("UNIQUE") || tok.is("CHECK") || tok.is("FOREIGN")
+}
+
+// A token of the statement; a word, a number, a quoted string or identifier, or a single character.
+type specToken struct {
+	text       string // as written, quotes included.
+	start, end int    // rune offsets in the statement.
+}
+
+// Whether the token is that keyword (or character), case insensitive. A quoted token is never a keyword.
+func (t specToken) is(keyword string) bool {
+	return strings.EqualFold(t.text, keyword)
+}
+
+// Whether the token can be a name; a word or a quoted one.
+func (t specToken) isName() bool {
+	if t.text == "" {
+		return false
+	}
+	ch := []rune(t.text)[0]
+	return unicode.IsLetter(ch) || ch == '_' || ch == '"' || ch == '\'' || ch == '`' || ch == '['
+}
+
+// The name without its quotes. e.g. "my ""col""" is my "col"
+func (t specToken) name() string {
+	text := t.text
+	if len(text) < 2 {
+		return text
+	}
+	switch text[0] {
+	case '[':
+		return strings.TrimSuffix(text[1:], "]")
+	case '"', '\'', '`':
+		quote := text[:1]
+		return strings.ReplaceAll(strings.TrimSuffix(text[1:], quote), quote+quote, quote)
+	}
+	return text
+}
+
+type specParser struct {
+	text   []rune
+	tokens []specToken
+	at     int
+}
+
+func newSpecParser(sqlText string) *specParser {
+	text := []rune(sqlText)
+	var tokens []specToken
+	for i := skipSpaceAndComments(text, 0); i < len(text); i = skipSpaceAndComments(text, i) {
+		end := i + 1
+		switch ch := text[i]; {
+		case ch == '\'' || ch == '"' || ch == '`' || ch == '[':
+			end = skipQuoted(text, i)
+			// a doubled quote is part of it.
+			for ch != '[' && end < len(text) && text[end] == ch && text[end-1] == ch {
+				end = skipQuoted(text, end)
+			}
+		case unicode.IsDigit(ch) || ch == '.' && i+1 < len(text) && unicode.IsDigit(text[i+1]):
+			end = scanNumber(text, i)
+		case (ch == 'x' || ch == 'X') && i+1 < len(text) && text[i+1] == '\'':
+			// a blob literal. e.g. x'41'
+			end = skipQuoted(text, i+1)
+		case unicode.IsLetter(ch) || ch == '_':
+			_, end = wordAt(text, i)
+		}
+		tokens = append(tokens, specToken{text: string(text[i:end]), start: i, end: end})
+		i = end
+	}
+	return &specParser{text: text, tokens: tokens}
+}
+
+// The end of the number starting at i. e.g. 12, 1.5e-3, 0x1F
+func scanNumber(text []rune, i int) int {
+	if text[i] == '0' && i+1 < len(text) && (text[i+1] == 'x' || text[i+1] == 'X') {
+		_, end := wordAt(text, i)
+		return end
+	}
+	end := i
+	for end < len(text) && (unicode.IsDigit(text[end]) || text[end] == '.') {
+		end++
+	}
+	if end < len(text) && (text[end] == 'e' || text[end] == 'E') {
+		exp := end + 1
+		if exp < len(text) && (text[exp] == '+' || text[exp] == '-') {
+			exp++
+		}
+		if exp < len(text) && unicode.IsDigit(text[exp]) {
+			for end = exp; end < len(text) && unicode.IsDigit(text[end]); end++ {
+			}
+		}
+	}
+	return end
+}
+
+// The current token, empty at the end.
+func (p *specParser) peek() specToken {
+	return p.peekAt(0)
+}
+
+func (p *specParser) peekAt(ahead int) specToken {
+	if p.at+ahead >= len(p.tokens) {
+		return specToken{start: len(p.text), end: len(p.text)}
+	}
+	return p.tokens[p.at+ahead]
+}
+
+func (p *specParser) next() specToken {
+	tok := p.peek()
+	if p.at < len(p.tokens) {
+		p.at++
+	}
+	return tok
+}
+
+func (p *specParser) done() bool {
+	return p.at >= len(p.tokens)
+}
+
+// Move past the keywords if they come next, all of them.
+func (p *specParser) accept(keywords ...string) bool {
+	for k, keyword := range keywords {
+		if !p.peekAt(k).is(keyword) {
+			return false
+		}
+	}
+	p.at += len(keywords)
+	return true
+}
+
+func (p *specParser) expect(keywords ...string) error {
+	for _, keyword := range keywords {
+		if !p.accept(keyword) {
+			return p.syntaxError()
+		}
+	}
+	return nil
+}
+
+// Like sqlite3 reports it.
+func (p *specParser) syntaxError() error {
+	if p.done() {
+		return fmt.Errorf("incomplete input")
+	}
+	return fmt.Errorf("near \"%s\": syntax error", p.peek().text)
+}
+
+func (p *specParser) identifier(what string) (string, error) {
+	tok := p.peek()
+	if !tok.isName() {
+		if p.done() {
+			return "", p.syntaxError()
+		}
+		return "", fmt.Errorf("near \"%s\": syntax error, expected %s", tok.text, what)
+	}
+	p.next()
+	return tok.name(), nil
+}
+
+// Move past the parentheses and what is inside, nested ones included. Returns what is inside, as written.
+func (p *specParser) parenthesized() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	start := p.at
+	for depth := 1; ; {
+		tok := p.next()
+		switch {
+		case tok.text == "":
+			return "", p.syntaxError()
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+			if depth == 0 {
+				return string(p.text[p.tokens[start].start:tok.start]), nil
+			}
+		}
+	}
+}
+
+// The statement as written from the token at `from` up to the current one.
+func (p *specParser) textSince(from int) string {
+	if p.at <= from {
+		return ""
+	}
+	return string(p.text[p.tokens[from].start:p.tokens[p.at-1].end])
+}
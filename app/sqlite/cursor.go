@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// Same limit as SQLite's BTCURSOR_MAX_DEPTH, a deeper tree is most likely a loop in a corrupted file.
+const MAX_BTREE_DEPTH = 20
+
+// A position within one page of the b-tree.
+type cursorFrame struct {
+	pageNumber int64
+	page       *btree.TableBTreePage
+	cellIndex  int // next cell to visit; for interior pages len(cells) means the right most pointer.
+}
+
+// Walk through the rows of a table in rowid order, loading pages only when they are reached.
+//
+// Only the pages from the root down to the current leaf are held at any time.
+//
+//	cur := tbl.NewCursor()
+//	defer cur.Close()
+//	for cur.Next() {
+//		fmt.Println(cur.Rowid(), cur.Column(1))
+//	}
+//	if err := cur.Err(); err != nil { ... }
+type Cursor struct {
+	table    *DBTable
+	stack    []cursorFrame
+	cell     *btree.TableBTreeLeafTablePageCell
+	from, to int64 // rowids, inclusive.
+	started  bool
+	err      error
+}
+
+func (t *DBTable) NewCursor() *Cursor {
+	return t.NewRangeCursor(math.MinInt64, math.MaxInt64)
+}
+
+// A cursor over the rows whose rowid is within from..to (inclusive), the first one is found by binary search.
+func (t *DBTable) NewRangeCursor(from int64, to int64) *Cursor {
+	return &Cursor{
+		table: t,
+		stack: make([]cursorFrame, 0, 4),
+		from:  from,
+		to:    to,
+	}
+}
+
+// Move to the next row; false when the table is exhausted (or an error occurred, see Err()).
+func (c *Cursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if !c.started {
+		c.started = true
+		if err := c.push(int64(c.table.rootPage)); err != nil {
+			return c.fail(err)
+		}
+		if c.from != math.MinInt64 {
+			if err := c.seek(c.from); err != nil {
+				return c.fail(err)
+			}
+		}
+	}
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		page := top.page
+		switch page.Header.PageType {
+		case btree.LeafTable:
+			if top.cellIndex < len(page.CellOffsets) {
+				cell, err := page.ReadTableLeafCell(top.cellIndex, c.table.rowIdAliasColIndex)
+				if err != nil {
+					return c.fail(c.table.db.pageError(top.pageNumber, err))
+				}
+				top.cellIndex++
+				if cell.Rowid > c.to {
+					// past the range.
+					c.stack = nil
+					c.cell = nil
+					return false
+				}
+				c.cell = cell
+				return true
+			}
+			c.pop()
+		case btree.InteriorTable:
+			if top.cellIndex < len(page.CellOffsets) {
+				cell, err := page.ReadTableInteriorCell(int(page.CellOffsets[top.cellIndex]))
+				if err != nil {
+					return c.fail(c.table.db.pageError(top.pageNumber, err))
+				}
+				top.cellIndex++
+				if err := c.push(int64(cell.LeftPageNumber)); err != nil {
+					return c.fail(err)
+				}
+			} else if top.cellIndex == len(page.CellOffsets) {
+				top.cellIndex++
+				if err := c.push(int64(page.Header.RightMostPointer)); err != nil {
+					return c.fail(err)
+				}
+			} else {
+				c.pop()
+			}
+		default:
+			return c.fail(newPageError(ErrUnsupported, top.pageNumber, 0, fmt.Errorf("unsupported page type %#x in table b-tree", page.Header.PageType)))
+		}
+	}
+	c.cell = nil
+	return false
+}
+
+// Position the cursor on the path down to the first row whose rowid is at least `rowid`.
+func (c *Cursor) seek(rowid int64) error {
+	for {
+		top := &c.stack[len(c.stack)-1]
+		page := top.page
+		var readErr error
+		switch page.Header.PageType {
+		case btree.LeafTable:
+			top.cellIndex = sort.Search(len(page.CellOffsets), func(j int) bool {
+				cellRowid, err := page.ReadTableLeafRowid(j)
+				if err != nil {
+					readErr = err
+					return true
+				}
+				return cellRowid >= rowid
+			})
+			if readErr != nil {
+				return c.table.db.pageError(top.pageNumber, readErr)
+			}
+			return nil
+		case btree.InteriorTable:
+			// the left page of the first cell whose key is at least the rowid, or the right most page.
+			j := sort.Search(len(page.CellOffsets), func(j int) bool {
+				cell, err := page.ReadTableInteriorCell(int(page.CellOffsets[j]))
+				if err != nil {
+					readErr = err
+					return true
+				}
+				return cell.Rowid >= rowid
+			})
+			if readErr != nil {
+				return c.table.db.pageError(top.pageNumber, readErr)
+			}
+			top.cellIndex = j + 1
+			child := int64(page.Header.RightMostPointer)
+			if j < len(page.CellOffsets) {
+				cell, err := page.ReadTableInteriorCell(int(page.CellOffsets[j]))
+				if err != nil {
+					return c.table.db.pageError(top.pageNumber, err)
+				}
+				child = int64(cell.LeftPageNumber)
+			}
+			if err := c.push(child); err != nil {
+				return err
+			}
+		default:
+			return newPageError(ErrUnsupported, top.pageNumber, 0, fmt.Errorf("unsupported page type %#x in table b-tree", page.Header.PageType))
+		}
+	}
+}
+
+func (c *Cursor) push(pageNumber int64) error {
+	if len(c.stack) >= MAX_BTREE_DEPTH {
+		return newPageError(ErrCorrupt, pageNumber, 0, fmt.Errorf("table b-tree of %s is deeper than %d pages", c.table.Name(), MAX_BTREE_DEPTH))
+	}
+	page, err := c.table.db.readPage(pageNumber - 1)
+	if err != nil {
+		return err
+	}
+	c.stack = append(c.stack, cursorFrame{pageNumber: pageNumber, page: page})
+	return nil
+}
+
+func (c *Cursor) pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+func (c *Cursor) fail(err error) bool {
+	c.err = err
+	c.cell = nil
+	c.stack = nil
+	return false
+}
+
+// The current row.
+func (c *Cursor) Row() Row {
+	return Row{cell: c.cell, table: c.table}
+}
+
+func (c *Cursor) Rowid() int64 {
+	return c.cell.Rowid
+}
+
+func (c *Cursor) Column(columnIndex int) btree.Value {
+	row := c.Row()
+	return row.Column(columnIndex)
+}
+
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+func (c *Cursor) Close() error {
+	c.stack = nil
+	c.cell = nil
+	return nil
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const HEADER_MAGIC = "SQLite format 3\x00"
+
+type TextEncoding uint32
+
+const (
+	UTF8    TextEncoding = 1
+	UTF16le TextEncoding = 2
+	UTF16be TextEncoding = 3
+)
+
+func (e TextEncoding) String() string {
+	switch e {
+	case UTF8:
+		return "utf8"
+	case UTF16le:
+		return "utf16le"
+	case UTF16be:
+		return "utf16be"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(e))
+}
+
+// The first 100 bytes of the database file.
+//
+// See "The Database Header" in https://www.sqlite.org/fileformat.html
+type DatabaseHeader struct {
+	Magic               [16]byte     // offset 0: "SQLite format 3\0"
+	PageSize            uint32       // offset 16: stored as 2 bytes; 1 means 65536.
+	WriteVersion        uint8        // offset 18: 1 = legacy; 2 = WAL.
+	ReadVersion         uint8        // offset 19: 1 = legacy; 2 = WAL.
+	ReservedBytes       uint8        // offset 20: unused space at the end of each page.
+	MaxPayloadFraction  uint8        // offset 21: must be 64.
+	MinPayloadFraction  uint8        // offset 22: must be 32.
+	LeafPayloadFraction uint8        // offset 23: must be 32.
+	FileChangeCounter   uint32       // offset 24
+	DatabaseSizeInPages uint32       // offset 28: only valid when VersionValidFor == FileChangeCounter.
+	FreelistTrunkPage   uint32       // offset 32: 0 means no freelist.
+	FreelistPageCount   uint32       // offset 36
+	SchemaCookie        uint32       // offset 40
+	SchemaFormat        uint32       // offset 44: 1, 2, 3 or 4.
+	DefaultCacheSize    uint32       // offset 48
+	AutovacuumTopRoot   uint32       // offset 52: largest root b-tree page when in auto-vacuum modes, otherwise 0.
+	TextEncoding        TextEncoding // offset 56
+	UserVersion         uint32       // offset 60
+	IncrementalVacuum   uint32       // offset 64: non-zero for incremental-vacuum mode.
+	ApplicationID       uint32       // offset 68
+	VersionValidFor     uint32       // offset 92
+	SQLiteVersionNumber uint32       // offset 96: SQLITE_VERSION_NUMBER of the library that most recently modified the file.
+}
+
+// Parse the 100 bytes database header and check the fields for sanity.
+func ParseDatabaseHeader(raw []byte) (*DatabaseHeader, error) {
+	if len(raw) < HEADER_SIZE {
+		return nil, newPageError(ErrNotADatabase, 1, 0, fmt.Errorf("database header is too short: %d bytes", len(raw)))
+	}
+	if !bytes.Equal(raw[0:16], []byte(HEADER_MAGIC)) {
+		return nil, newPageError(ErrNotADatabase, 1, 0, fmt.Errorf("invalid magic string %q", raw[0:16]))
+	}
+	h := &DatabaseHeader{
+		PageSize:            uint32(binary.BigEndian.Uint16(raw[16:18])),
+		WriteVersion:        raw[18],
+		ReadVersion:         raw[19],
+		ReservedBytes:       raw[20],
+		MaxPayloadFraction:  raw[21],
+		MinPayloadFraction:  raw[22],
+		LeafPayloadFraction: raw[23],
+		FileChangeCounter:   binary.BigEndian.Uint32(raw[24:28]),
+		DatabaseSizeInPages: binary.BigEndian.Uint32(raw[28:32]),
+		FreelistTrunkPage:   binary.BigEndian.Uint32(raw[32:36]),
+		FreelistPageCount:   binary.BigEndian.Uint32(raw[36:40]),
+		SchemaCookie:        binary.BigEndian.Uint32(raw[40:44]),
+		SchemaFormat:        binary.BigEndian.Uint32(raw[44:48]),
+		DefaultCacheSize:    binary.BigEndian.Uint32(raw[48:52]),
+		AutovacuumTopRoot:   binary.BigEndian.Uint32(raw[52:56]),
+		TextEncoding:        TextEncoding(binary.BigEndian.Uint32(raw[56:60])),
+		UserVersion:         binary.BigEndian.Uint32(raw[60:64]),
+		IncrementalVacuum:   binary.BigEndian.Uint32(raw[64:68]),
+		ApplicationID:       binary.BigEndian.Uint32(raw[68:72]),
+		VersionValidFor:     binary.BigEndian.Uint32(raw[92:96]),
+		SQLiteVersionNumber: binary.BigEndian.Uint32(raw[96:100]),
+	}
+	copy(h.Magic[:], raw[0:16])
+	if h.PageSize == 1 {
+		h.PageSize = 65536
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *DatabaseHeader) validate() error {
+	if h.PageSize < 512 || h.PageSize > 65536 || h.PageSize&(h.PageSize-1) != 0 {
+		return newPageError(ErrNotADatabase, 1, 16, fmt.Errorf("invalid page size %d", h.PageSize))
+	}
+	if h.WriteVersion != 1 && h.WriteVersion != 2 {
+		return newPageError(ErrNotADatabase, 1, 18, fmt.Errorf("invalid file format write version %d", h.WriteVersion))
+	}
+	if h.ReadVersion != 1 && h.ReadVersion != 2 {
+		return newPageError(ErrNotADatabase, 1, 19, fmt.Errorf("invalid file format read version %d", h.ReadVersion))
+	}
+	if h.UsableSize() < 480 {
+		return newPageError(ErrNotADatabase, 1, 20, fmt.Errorf("usable size %d (page size %d - reserved %d) is less than 480", h.UsableSize(), h.PageSize, h.ReservedBytes))
+	}
+	if h.MaxPayloadFraction != 64 || h.MinPayloadFraction != 32 || h.LeafPayloadFraction != 32 {
+		return newPageError(ErrNotADatabase, 1, 21, fmt.Errorf("invalid payload fractions %d/%d/%d", h.MaxPayloadFraction, h.MinPayloadFraction, h.LeafPayloadFraction))
+	}
+	// 0 is allowed for both of these; it means the database is still empty.
+	if h.SchemaFormat > 4 {
+		return newPageError(ErrNotADatabase, 1, 44, fmt.Errorf("invalid schema format %d", h.SchemaFormat))
+	}
+	if h.TextEncoding > UTF16be {
+		return newPageError(ErrNotADatabase, 1, 56, fmt.Errorf("invalid text encoding %d", h.TextEncoding))
+	}
+	if h.TextEncoding == UTF16le || h.TextEncoding == UTF16be {
+		// text is only decoded as UTF-8.
+		return newPageError(ErrUnsupported, 1, 56, fmt.Errorf("%s text encoding", h.TextEncoding))
+	}
+	return nil
+}
+
+// The number of bytes of each page that can hold content.
+func (h *DatabaseHeader) UsableSize() int {
+	return int(h.PageSize) - int(h.ReservedBytes)
+}
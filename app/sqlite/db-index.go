@@ -0,0 +1,413 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+type DBIndex struct {
+	Schema
+	db         *Db
+	assocTable string // associated table that utilize this index.
+	indexSpec  *sql.CreateIndexStatement
+	columns    []indexColumn
+	// leading columns that make the key, the rest come along. (PRIMARY KEY columns of a WITHOUT ROWID table)
+	keyColumns int
+	// entries end with the PRIMARY KEY columns (part of columns) instead of a rowid; the table is WITHOUT ROWID.
+	withoutRowid bool
+	// the b-tree of a WITHOUT ROWID table itself; its PRIMARY KEY columns followed by the other ones.
+	primaryKey bool
+}
+
+// A column of the index key, in the order it is stored.
+type indexColumn struct {
+	name      string
+	desc      bool
+	collation string   // upper cased, BINARY by default.
+	expr      sql.Expr // what an expression column computes, nil for a column of the table.
+}
+
+// One end of a range of values; a nil bound is open.
+type indexBound struct {
+	value     btree.Value
+	inclusive bool
+}
+
+// A run of consecutive index entries: the ones whose leading columns equal `equal`,
+// and whose next column lies between `lower` and `upper`. Without anything, all entries.
+type indexSeek struct {
+	equal []btree.Value
+	lower *indexBound
+	upper *indexBound
+}
+
+// Compare a field of an index entry with a value the way the index orders that column; by its collation, reversed for DESC.
+func (i *DBIndex) compareField(k int, field btree.Value, v btree.Value) int {
+	c := btree.CompareCollated(field, v, i.columns[k].collation)
+	if i.columns[k].desc {
+		return -c
+	}
+	return c
+}
+
+// Compare the leading fields of an index entry with the key, fields beyond the key are not compared.
+func (i *DBIndex) compareKey(fields []btree.TableBTreeLeafPageCellField, key []btree.Value) int {
+	for k, v := range key {
+		if k >= len(fields) {
+			return -1
+		}
+		if c := i.compareField(k, fields[k].Value(), v); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// The bounds of the seek in index order; swapped for a DESC column.
+func (i *DBIndex) seekBounds(s *indexSeek) (*indexBound, *indexBound) {
+	if i.columns[len(s.equal)].desc {
+		return s.upper, s.lower
+	}
+	return s.lower, s.upper
+}
+
+// Whether the entry comes before the first entry of the seek.
+func (i *DBIndex) beforeSeek(s *indexSeek, fields []btree.TableBTreeLeafPageCellField) bool {
+	if c := i.compareKey(fields, s.equal); c != 0 || (s.lower == nil && s.upper == nil) {
+		return c < 0
+	}
+	first, _ := i.seekBounds(s)
+	if first == nil {
+		return false
+	}
+	k := len(s.equal)
+	c := i.compareField(k, fields[k].Value(), first.value)
+	return c < 0 || (c == 0 && !first.inclusive)
+}
+
+// Whether the entry comes after the last entry of the seek.
+func (i *DBIndex) afterSeek(s *indexSeek, fields []btree.TableBTreeLeafPageCellField) bool {
+	if c := i.compareKey(fields, s.equal); c != 0 || (s.lower == nil && s.upper == nil) {
+		return c > 0
+	}
+	_, last := i.seekBounds(s)
+	if last == nil {
+		return false
+	}
+	k := len(s.equal)
+	c := i.compareField(k, fields[k].Value(), last.value)
+	return c > 0 || (c == 0 && !last.inclusive)
+}
+
+func (s *indexSeek) String() string {
+	var b strings.Builder
+	for k, v := range s.equal {
+		if k > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteValue(v))
+	}
+	if s.lower != nil {
+		op := " >"
+		if s.lower.inclusive {
+			op = " >="
+		}
+		fmt.Fprintf(&b, "%s %s", op, quoteValue(s.lower.value))
+	}
+	if s.upper != nil {
+		op := " <"
+		if s.upper.inclusive {
+			op = " <="
+		}
+		fmt.Fprintf(&b, "%s %s", op, quoteValue(s.upper.value))
+	}
+	return "(" + strings.TrimSpace(b.String()) + ")"
+}
+
+// `tbl` is the indexed table, its columns' COLLATE applies unless the index has its own.
+func NewDbIndex(db *Db, schema *Schema, indexSpec *sql.CreateIndexStatement, tbl *DBTable) *DBIndex {
+	var columns = []indexColumn{}
+	debugf("Index Spec: %s (page=%d) %d columns for %s\n", indexSpec.Name.Name, schema.rootPage, len(indexSpec.Columns), indexSpec.Table.Name)
+	for _, col := range indexSpec.Columns {
+		column := indexColumn{
+			name:      strings.ReplaceAll(col.X.String(), "\"", ""),
+			desc:      col.Desc.IsValid(),
+			collation: "BINARY",
+		}
+		ci, ok := tbl.ColumnIndex(column.name)
+		if _, isIdent := col.X.(*sql.Ident); !isIdent {
+			column.expr = col.X
+		} else if ok && ci >= 0 {
+			// named as the table declares it, CREATE INDEX may spell it in another case.
+			column.name = tbl.columnName(ci)
+		}
+		if col.Collation != nil {
+			column.collation = strings.ToUpper(col.Collation.Name)
+		} else if ok {
+			column.collation = tbl.columnCollation(ci)
+		}
+		debugf(" └─COL= %s desc=%v collate=%s\n", col.X.String(), column.desc, column.collation)
+		columns = append(columns, column)
+	}
+	keyColumns := len(columns)
+	if tbl.primaryKey != nil {
+		// entries of a WITHOUT ROWID table's index end with the PRIMARY KEY columns it does not have.
+		for _, pk := range tbl.primaryKey.columns[:tbl.primaryKey.keyColumns] {
+			if !hasIndexColumn(columns, pk.name) {
+				debugf(" └─PK= %s desc=%v collate=%s\n", pk.name, pk.desc, pk.collation)
+				columns = append(columns, pk)
+			}
+		}
+	}
+	// determine the associated table?
+	forTable := indexSpec.Table.Name
+
+	return &DBIndex{
+		db:           db,
+		indexSpec:    indexSpec,
+		columns:      columns,
+		keyColumns:   keyColumns,
+		withoutRowid: tbl.primaryKey != nil,
+		Schema:       *schema,
+		assocTable:   forTable,
+	}
+}
+
+// The b-tree of a WITHOUT ROWID table, an index keyed by its PRIMARY KEY. (see DBIndex.primaryKey)
+func newPrimaryKeyIndex(db *Db, schema *Schema, tbl *DBTable) (*DBIndex, error) {
+	var columns []indexColumn
+	for ci, col := range tbl.tableSpec.Columns {
+		if pk := col.Constraint(PrimaryKeyConstraint); pk != nil {
+			columns = append(columns, indexColumn{name: col.Name, desc: pk.Desc, collation: tbl.columnCollation(ci)})
+		}
+	}
+	for _, constraint := range tbl.tableSpec.Constraints {
+		if constraint.Kind != PrimaryKeyConstraint {
+			continue
+		}
+		for _, col := range constraint.Columns {
+			column := indexColumn{name: col.Name, desc: col.Desc, collation: strings.ToUpper(col.Collation)}
+			ci, ok := tbl.ColumnIndex(col.Name)
+			if !ok || ci < 0 {
+				return nil, fmt.Errorf("%w: no such column %s in the PRIMARY KEY of %s", ErrCorrupt, col.Name, tbl.Name())
+			}
+			column.name = tbl.tableSpec.Columns[ci].Name
+			if column.collation == "" {
+				column.collation = tbl.columnCollation(ci)
+			}
+			if !hasIndexColumn(columns, column.name) {
+				columns = append(columns, column)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: PRIMARY KEY missing on table %s", ErrCorrupt, tbl.Name())
+	}
+	keyColumns := len(columns)
+	for ci, col := range tbl.tableSpec.Columns {
+		// VIRTUAL generated columns are not in the record.
+		if !hasIndexColumn(columns, col.Name) && tbl.virtualColumn(ci) == nil {
+			columns = append(columns, indexColumn{name: col.Name, collation: "BINARY"})
+		}
+	}
+	debugf("Primary Key: %s (page=%d) %d of %d columns\n", tbl.Name(), schema.rootPage, keyColumns, len(columns))
+	return &DBIndex{
+		db: db,
+		indexSpec: &sql.CreateIndexStatement{
+			Name:   &sql.Ident{Name: "sqlite_autoindex_" + tbl.Name() + "_1"},
+			Table:  &sql.Ident{Name: tbl.Name()},
+			Unique: sql.Pos{Line: 1}, // the PRIMARY KEY is unique.
+		},
+		columns:      columns,
+		keyColumns:   keyColumns,
+		withoutRowid: true,
+		primaryKey:   true,
+		Schema:       *schema,
+		assocTable:   tbl.Name(),
+	}, nil
+}
+
+func hasIndexColumn(columns []indexColumn, name string) bool {
+	for _, col := range columns {
+		if strings.EqualFold(col.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *DBIndex) Name() string {
+	return i.indexSpec.Name.Name
+}
+
+// Most seeks one lookup may turn into, e.g. `a IN (1, 2, 3) AND b IN (4, 5)` takes 6.
+const MAX_INDEX_SEEKS = 1000
+
+// What part of the constraints the seeks of an index use.
+type seekUse struct {
+	equal        int  // leading columns compared for equality.
+	lower, upper bool // bounds of the column after those.
+}
+
+func (u seekUse) used() bool {
+	return u.equal > 0 || u.lower || u.upper
+}
+
+// Seeks for the constraints on the leading index columns: equalities (a seek per combination of IN values),
+// then maybe a range on the next column.
+//
+// Like sqlite3, a column is only of use when it has the collation the terms compare by.
+func (i *DBIndex) seeksFor(where map[string]*columnConstraint) ([]indexSeek, seekUse) {
+	seeks := []indexSeek{{}}
+	use := seekUse{}
+	columns := i.columns
+	if i.primaryKey {
+		// the other columns are not in order.
+		columns = columns[:i.keyColumns]
+	}
+	for k, col := range columns {
+		c, ok := where[col.name]
+		if !ok || !knownCollation(col.collation) || col.collation != c.collation {
+			break
+		}
+		if c.values != nil {
+			values := i.distinctValues(k, c.values)
+			if len(seeks)*len(values) > MAX_INDEX_SEEKS {
+				break
+			}
+			next := make([]indexSeek, 0, len(seeks)*len(values))
+			for _, seek := range seeks {
+				for _, v := range values {
+					equal := append(append([]btree.Value{}, seek.equal...), v)
+					next = append(next, indexSeek{equal: equal})
+				}
+			}
+			seeks = next
+			use.equal++
+			continue
+		}
+		if c.lower != nil || c.upper != nil {
+			lower := c.lower
+			if lower == nil {
+				// NULL is never within the range.
+				lower = &indexBound{value: btree.NullValue()}
+			}
+			for s := range seeks {
+				seeks[s].lower, seeks[s].upper = lower, c.upper
+			}
+			use.lower, use.upper = c.lower != nil, c.upper != nil
+		}
+		break
+	}
+	return seeks, use
+}
+
+// The constraints the seeks use, as EXPLAIN QUERY PLAN shows them. e.g. "a=? AND b>?"
+func (i *DBIndex) seekTerms(use seekUse) string {
+	var terms []string
+	for k := 0; k < use.equal; k++ {
+		terms = append(terms, i.columns[k].name+"=?")
+	}
+	if use.lower {
+		terms = append(terms, i.columns[use.equal].name+">?")
+	}
+	if use.upper {
+		terms = append(terms, i.columns[use.equal].name+"<?")
+	}
+	return strings.Join(terms, " AND ")
+}
+
+func knownCollation(name string) bool {
+	return name == "BINARY" || name == "NOCASE" || name == "RTRIM"
+}
+
+// The values in the order of the index column, the ones equal by its collation only once.
+func (i *DBIndex) distinctValues(k int, values []btree.Value) []btree.Value {
+	sorted := append([]btree.Value{}, values...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return i.compareField(k, sorted[a], sorted[b]) < 0
+	})
+	distinct := sorted[:0]
+	for v := range sorted {
+		if v == 0 || i.compareField(k, sorted[v], sorted[v-1]) != 0 {
+			distinct = append(distinct, sorted[v])
+		}
+	}
+	return distinct
+}
+
+// Index entries of the seeks, in index order. Each is the indexed columns followed by the rowid. (see withoutRowid)
+func (i *DBIndex) SeekEntries(seeks []indexSeek) ([][]btree.TableBTreeLeafPageCellField, error) {
+	start := time.Now()
+	entries := [][]btree.TableBTreeLeafPageCellField{}
+	cur := i.newSeekCursor(seeks, false)
+	defer cur.Close()
+	for cur.Next() {
+		entries = append(entries, cur.Entry())
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+	texts := make([]string, len(seeks))
+	for s := range seeks {
+		texts[s] = seeks[s].String()
+	}
+	debugf("Index %s seek %s -> matched %d rowids. Done in %s\n", i.Name(), strings.Join(texts, " "), len(entries), elapsed)
+	return entries, nil
+}
+
+// Rowids of the index entries of the seeks, in index order.
+func (i *DBIndex) Seek(seeks []indexSeek) ([]int64, error) {
+	entries, err := i.SeekEntries(seeks)
+	if err != nil {
+		return nil, err
+	}
+	rowIds := make([]int64, len(entries))
+	for r, fields := range entries {
+		if rowIds[r], err = i.entryRowid(fields); err != nil {
+			return nil, err
+		}
+	}
+	return rowIds, nil
+}
+
+// The rowid of an index entry, 0 for a WITHOUT ROWID table.
+func (i *DBIndex) entryRowid(fields []btree.TableBTreeLeafPageCellField) (int64, error) {
+	if i.withoutRowid {
+		return 0, nil
+	}
+	if len(fields) <= len(i.columns) {
+		return 0, fmt.Errorf("%w: index %s entry has %d fields, expected %d", ErrCorrupt, i.Name(), len(fields), len(i.columns)+1)
+	}
+	return fields[len(i.columns)].Integer(), nil
+}
+
+// Seeks of the PRIMARY KEY of the index entries, to look up the rows of a WITHOUT ROWID table in that order.
+func (i *DBIndex) primaryKeySeeks(pk *DBIndex, entries [][]btree.TableBTreeLeafPageCellField) []indexSeek {
+	positions := make([]int, pk.keyColumns)
+	for k, col := range pk.columns[:pk.keyColumns] {
+		for c := range i.columns {
+			if strings.EqualFold(i.columns[c].name, col.name) {
+				positions[k] = c
+				break
+			}
+		}
+	}
+	seeks := make([]indexSeek, len(entries))
+	for e, fields := range entries {
+		equal := make([]btree.Value, len(positions))
+		for k, c := range positions {
+			if c < len(fields) {
+				equal[k] = fields[c].Value()
+			}
+		}
+		seeks[e] = indexSeek{equal: equal}
+	}
+	return seeks
+}
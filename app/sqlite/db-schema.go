@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+type SchemaType int8
+
+const (
+	Table SchemaType = iota
+	Index
+	View
+	Trigger
+	Unknown
+)
+
+type Schema struct {
+	schemaType SchemaType
+	name       string
+	tblName    string
+	sql        string
+	rootPage   int64
+}
+
+type DBSchema interface {
+	Name() string
+}
+
+func (t SchemaType) String() string {
+	switch t {
+	case Table:
+		return "table"
+	case Index:
+		return "index"
+	case View:
+		return "view"
+	case Trigger:
+		return "trigger"
+	}
+	return "unknown"
+}
+
+// A row of sqlite_schema.
+func (s *Schema) Type() SchemaType {
+	return s.schemaType
+}
+
+func (s *Schema) Name() string {
+	return s.name
+}
+
+// Name of the table this object is associated with.
+func (s *Schema) TableName() string {
+	return s.tblName
+}
+
+func (s *Schema) SQL() string {
+	return s.sql
+}
+
+func (s *Schema) RootPage() int64 {
+	return s.rootPage
+}
+
+func typeFromRawString(str string) SchemaType {
+	switch str {
+	case "table":
+		return Table
+	case "index":
+		return Index
+	case "view":
+		return View
+	case "trigger":
+		return Trigger
+	}
+	return Unknown
+}
+
+// Read a row of sqlite_schema: (type, name, tbl_name, rootpage, sql)
+func NewSchema(cell *btree.TableBTreeLeafTablePageCell) (*Schema, error) {
+	if len(cell.Fields) < 5 {
+		return nil, fmt.Errorf("sqlite_schema row %d has %d columns, expected 5", cell.Rowid, len(cell.Fields))
+	}
+	typeStr := string(cell.Fields[0].String())
+	name := string(cell.Fields[1].String())
+	tblName := string(cell.Fields[2].String())
+	schemaType := typeFromRawString(typeStr)
+	rootPage := cell.Fields[3].Integer()
+
+	return &Schema{
+		schemaType: schemaType,
+		name:       name,
+		tblName:    tblName,
+		sql:        cell.Fields[4].String(),
+		rootPage:   rootPage,
+	}, nil
+}
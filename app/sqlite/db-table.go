@@ -0,0 +1,740 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// Convert this to Generic?
+type _SearchList struct {
+	currentIndex int
+	sortedRowIds []int64
+	result       []*btree.TableBTreeLeafTablePageCell
+}
+
+func NewSearchList(rowIds []int64) *_SearchList {
+	// Asecending Order
+	sort.Slice(rowIds, func(i, j int) bool {
+		return rowIds[i] < rowIds[j]
+	})
+	return &_SearchList{
+		currentIndex: 0,
+		sortedRowIds: rowIds,
+		result:       make([]*btree.TableBTreeLeafTablePageCell, len(rowIds)),
+	}
+}
+
+// the lease rowIds (lease value to search for)
+func (s *_SearchList) current() int64 {
+	return s.sortedRowIds[s.currentIndex]
+}
+
+// record the row of the current rowid, and move next.
+func (s *_SearchList) matched(r *btree.TableBTreeLeafTablePageCell) {
+	s.result[s.currentIndex] = r
+	s.currentIndex++
+}
+
+// give up on the current rowid. (it does not exist)
+func (s *_SearchList) skip() {
+	s.currentIndex++
+}
+
+// whether there are rowids left to search for.
+func (s *_SearchList) hasMore() bool {
+	return s.currentIndex < len(s.sortedRowIds)
+}
+
+// Find the rows of the (sorted) rowids in the table b-tree at pageNumber. Each page binary searches its cells,
+// and all the rowids under the same page share the one descent into it. `depth` is the number of pages above, a
+// b-tree deeper than MAX_BTREE_DEPTH is corrupt. (e.g. a page that is its own child)
+func walkThroughBTreeForRowId(db *Db, pageNumber int64, pad *_SearchList, rowIdAliasColIndex int, depth int) error {
+	if depth >= MAX_BTREE_DEPTH {
+		return newPageError(ErrCorrupt, pageNumber, 0, fmt.Errorf("table b-tree is deeper than %d pages", MAX_BTREE_DEPTH))
+	}
+	pageIndex := pageNumber - 1
+	page, err := db.readPage(pageIndex)
+	if err != nil {
+		return err
+	}
+	cellCount := len(page.CellOffsets)
+	var readErr error
+	switch page.Header.PageType {
+	case btree.LeafTable:
+		// the rowids come in order, each one is after the cell of the previous one.
+		from := 0
+		for pad.hasMore() {
+			target := pad.current()
+			at := from + sort.Search(cellCount-from, func(c int) bool {
+				rowid, err := page.ReadTableLeafRowid(from + c)
+				if err != nil {
+					readErr = err
+					return true
+				}
+				return rowid >= target
+			})
+			if readErr != nil {
+				return db.pageError(pageNumber, readErr)
+			}
+			if at == cellCount {
+				// beyond this page; the parent knows where to look.
+				return nil
+			}
+			cell, err := page.ReadTableLeafCell(at, rowIdAliasColIndex)
+			if err != nil {
+				return db.pageError(pageNumber, err)
+			}
+			if cell.Rowid == target {
+				pad.matched(cell)
+				from = at + 1
+			} else {
+				pad.skip()
+				from = at
+			}
+		}
+	case btree.InteriorTable:
+		// the left page of a cell holds the rowids up to its key, the right most page the ones after the last key.
+		from := 0
+		for pad.hasMore() {
+			target := pad.current()
+			j := from + sort.Search(cellCount-from, func(c int) bool {
+				cell, err := page.ReadTableInteriorCell(int(page.CellOffsets[from+c]))
+				if err != nil {
+					readErr = err
+					return true
+				}
+				return cell.Rowid >= target
+			})
+			if readErr != nil {
+				return db.pageError(pageNumber, readErr)
+			}
+			if j == cellCount {
+				return walkThroughBTreeForRowId(db, int64(page.Header.RightMostPointer), pad, rowIdAliasColIndex, depth+1)
+			}
+			cell, err := page.ReadTableInteriorCell(int(page.CellOffsets[j]))
+			if err != nil {
+				return db.pageError(pageNumber, err)
+			}
+			if err := walkThroughBTreeForRowId(db, int64(cell.LeftPageNumber), pad, rowIdAliasColIndex, depth+1); err != nil {
+				return err
+			}
+			// the ones up to the key the left page did not have do not exist.
+			for pad.hasMore() && pad.current() <= cell.Rowid {
+				pad.skip()
+			}
+			from = j + 1
+		}
+	default:
+		return newPageError(ErrUnsupported, pageNumber, 0, fmt.Errorf("unsupported page type %#x in table b-tree", page.Header.PageType))
+	}
+	return nil
+}
+
+// Abstraction table
+type DBTable struct {
+	Schema
+	rowIdAliasColIndex int // -1 means no alias, otherwise colIndex that uses rowId instead.
+	colIndexMap        map[string]int
+	tableSpec          *TableSpec
+	db                 *Db
+	assocIndices       []*DBIndex
+	primaryKey         *DBIndex      // the b-tree of a WITHOUT ROWID table, nil for the others.
+	view               *DBView       // the rows of a view rather than a b-tree, see viewTable()
+	materialized       []Row         // rows of the view, once read.
+	defaults           []btree.Value // DEFAULT of each column, for records written before it was added.
+	recordFields       []int         // field of each column in the record, -1 for a VIRTUAL generated column.
+	virtual            []*generatedColumn
+}
+
+// A VIRTUAL generated column, computed from the other columns of the row instead of being stored in the record.
+type generatedColumn struct {
+	eval     evaluator
+	affinity btree.Affinity
+	err      error // why it cannot be computed, the queries reading the column fail with it.
+}
+
+// The value of the column for the row, converted by its affinity.
+func (g *generatedColumn) value(r *Row) btree.Value {
+	if g.eval == nil {
+		return btree.NullValue()
+	}
+	v, err := g.eval(&evalEnv{rows: []Row{*r}})
+	if err != nil {
+		return btree.NullValue()
+	}
+	return v.ApplyAffinity(g.affinity)
+}
+
+// Column index of the rowid when it is referred to by one of its names (see ROWID_NAMES) rather than an alias.
+const ROWID_COLUMN = -2
+
+// Names the rowid goes by, unless a column has that name.
+var ROWID_NAMES = []string{"rowid", "oid", "_rowid_"}
+
+func NewDBTable(db *Db, schema *Schema, tableSpec *TableSpec) (*DBTable, error) {
+	var colIndexMap = map[string]int{} // columnName ~> index
+	debugf("Table Spec: %s %d columns\n", tableSpec.Name, len(tableSpec.Columns))
+	for d, col := range tableSpec.Columns {
+		debugf(" └─COL= %s type=%q affinity=%s %v\n", col.Name, col.Type, col.Affinity, col.Constraints)
+		colIndexMap[col.Name] = d
+	}
+	rowIdAliasColIndex := rowidAlias(tableSpec)
+	if rowIdAliasColIndex >= 0 {
+		debugf(" └─ROWID= %s\n", tableSpec.Columns[rowIdAliasColIndex].Name)
+	}
+
+	t := &DBTable{
+		tableSpec:          tableSpec,
+		db:                 db,
+		rowIdAliasColIndex: rowIdAliasColIndex,
+		colIndexMap:        colIndexMap,
+		assocIndices:       []*DBIndex{},
+		Schema:             *schema,
+		defaults:           columnDefaults(tableSpec),
+	}
+	t.compileVirtualColumns()
+	if tableSpec.WithoutRowid {
+		primaryKey, err := newPrimaryKeyIndex(db, schema, t)
+		if err != nil {
+			return nil, err
+		}
+		t.primaryKey = primaryKey
+	}
+	return t, nil
+}
+
+// The DEFAULT values of the columns, converted by their affinity; NULL when there is none. ALTER TABLE ADD COLUMN only
+// takes constant defaults, those of other columns are never needed and stay NULL when they are not constant.
+// (e.g. CURRENT_TIMESTAMP)
+func columnDefaults(spec *TableSpec) []btree.Value {
+	defaults := make([]btree.Value, len(spec.Columns))
+	for ci, col := range spec.Columns {
+		constraint := col.Constraint(DefaultConstraint)
+		if constraint == nil {
+			continue
+		}
+		v, err := constantValue(constraint.Expr)
+		if err != nil {
+			debugf(" └─DEFAULT of %s is not constant: %v\n", col.Name, err)
+			continue
+		}
+		defaults[ci] = v.ApplyAffinity(col.Affinity)
+	}
+	return defaults
+}
+
+// The value of a constant expression as written. (e.g. `-2`, `'abc'` or `(1 + 2)`)
+func constantValue(text string) (btree.Value, error) {
+	expr, err := sql.ParseExprString(quoteKeywordNames(text))
+	if err != nil {
+		return btree.NullValue(), err
+	}
+	ev, _, err := compileExpr(expr, &scope{})
+	if err != nil {
+		return btree.NullValue(), err
+	}
+	return ev(&evalEnv{})
+}
+
+// Records hold all columns but the VIRTUAL generated ones, those are compiled against the other columns of the table.
+func (t *DBTable) compileVirtualColumns() {
+	t.recordFields = make([]int, len(t.tableSpec.Columns))
+	field := 0
+	for ci, col := range t.tableSpec.Columns {
+		generated := col.Constraint(GeneratedConstraint)
+		if generated == nil || generated.Stored {
+			t.recordFields[ci] = field
+			field++
+			continue
+		}
+		t.recordFields[ci] = -1
+		if t.virtual == nil {
+			t.virtual = make([]*generatedColumn, len(t.tableSpec.Columns))
+		}
+		g := &generatedColumn{affinity: col.Affinity}
+		expr, err := sql.ParseExprString(quoteKeywordNames(generated.Expr))
+		if err == nil {
+			sc := &scope{sources: []sourceTable{{name: t.Name(), table: t, used: map[int]bool{}}}}
+			g.eval, _, err = compileExpr(expr, sc)
+		}
+		if err != nil {
+			debugf(" └─GENERATED %s cannot be computed: %v\n", col.Name, err)
+			g.eval, g.err = nil, fmt.Errorf("generated column %s is not yet supported: %w", col.Name, err)
+		}
+		t.virtual[ci] = g
+	}
+}
+
+// The VIRTUAL generated column, nil for the others.
+func (t *DBTable) virtualColumn(columnIndex int) *generatedColumn {
+	if t.virtual == nil || columnIndex < 0 {
+		return nil
+	}
+	return t.virtual[columnIndex]
+}
+
+// Why the column cannot be read, nil when it can.
+func (t *DBTable) columnError(columnIndex int) error {
+	if g := t.virtualColumn(columnIndex); g != nil {
+		return g.err
+	}
+	return nil
+}
+
+// The value of a column missing from a record. (written before ALTER TABLE ADD COLUMN)
+func (t *DBTable) columnDefault(columnIndex int) btree.Value {
+	if columnIndex < 0 || columnIndex >= len(t.defaults) {
+		return btree.NullValue()
+	}
+	return t.defaults[columnIndex]
+}
+
+func (t *DBTable) Name() string {
+	return t.tableSpec.Name
+}
+
+// Column definitions, in table order.
+func (t *DBTable) Columns() []ColumnSpec {
+	return t.tableSpec.Columns
+}
+
+// Table constraints. (e.g. PRIMARY KEY (a, b)) The column constraints are on each column.
+func (t *DBTable) Constraints() []Constraint {
+	return t.tableSpec.Constraints
+}
+
+// The column that is the rowid, -1 for none. It is the INTEGER PRIMARY KEY, declared on the column or as the
+// table's PRIMARY KEY of that single column; the type has to be exactly INTEGER. Like sqlite3,
+// `INTEGER PRIMARY KEY DESC` on the column is not one, while `PRIMARY KEY (id DESC)` of the table is.
+func rowidAlias(spec *TableSpec) int {
+	if spec.WithoutRowid {
+		return -1
+	}
+	for d, col := range spec.Columns {
+		if pk := col.Constraint(PrimaryKeyConstraint); pk != nil {
+			if strings.EqualFold(col.Type, "INTEGER") && !pk.Desc {
+				return d
+			}
+			return -1
+		}
+	}
+	for _, constraint := range spec.Constraints {
+		if constraint.Kind != PrimaryKeyConstraint || len(constraint.Columns) != 1 {
+			continue
+		}
+		for d, col := range spec.Columns {
+			if strings.EqualFold(col.Name, constraint.Columns[0].Name) && strings.EqualFold(col.Type, "INTEGER") {
+				return d
+			}
+		}
+	}
+	return -1
+}
+
+// Look up a column by name, case insensitive like SQLite. The names of the rowid (see ROWID_NAMES) that no column
+// has give its alias, or ROWID_COLUMN. (a WITHOUT ROWID table or a view has none)
+func (t *DBTable) ColumnIndex(name string) (int, bool) {
+	if ci, ok := t.colIndexMap[name]; ok {
+		return ci, true
+	}
+	for colName, ci := range t.colIndexMap {
+		if strings.EqualFold(colName, name) {
+			return ci, true
+		}
+	}
+	for _, rowidName := range ROWID_NAMES {
+		if strings.EqualFold(name, rowidName) && t.hasRowid() {
+			if t.rowIdAliasColIndex >= 0 {
+				return t.rowIdAliasColIndex, true
+			}
+			return ROWID_COLUMN, true
+		}
+	}
+	return -1, false
+}
+
+func (t *DBTable) hasRowid() bool {
+	return t.primaryKey == nil && t.view == nil
+}
+
+// Whether the column is the rowid, its alias or ROWID_COLUMN.
+func (t *DBTable) isRowid(columnIndex int) bool {
+	return columnIndex == ROWID_COLUMN || (columnIndex >= 0 && columnIndex == t.rowIdAliasColIndex)
+}
+
+// Name of the column. The rowid is named after its alias, or the first of ROWID_NAMES no column has.
+func (t *DBTable) columnName(columnIndex int) string {
+	if columnIndex >= 0 {
+		return t.tableSpec.Columns[columnIndex].Name
+	}
+	return t.rowIdAliasName()
+}
+
+// Affinity of the column from its declared type. (the rowid alias is always an integer)
+func (t *DBTable) columnAffinity(columnIndex int) btree.Affinity {
+	if t.isRowid(columnIndex) {
+		return btree.IntegerAffinity
+	}
+	return t.tableSpec.Columns[columnIndex].Affinity
+}
+
+// Collation of the column from its COLLATE constraint, upper cased; BINARY by default.
+func (t *DBTable) columnCollation(columnIndex int) string {
+	if columnIndex < 0 {
+		return "BINARY"
+	}
+	if collate := t.tableSpec.Columns[columnIndex].Constraint(CollateConstraint); collate != nil {
+		return strings.ToUpper(collate.Collation)
+	}
+	return "BINARY"
+}
+
+// What the WHERE clause requires of a column: to equal one of `values` (= or IN) and/or to be within the bounds.
+type columnConstraint struct {
+	values    []btree.Value // in index order; nil when there is no = or IN term.
+	lower     *indexBound
+	upper     *indexBound
+	collation string // the terms compare by it, see comparisonCollation().
+}
+
+// Collect the terms comparing a column with literals from the top level ANDs of the WHERE clause, those can be looked up
+// through the rowid or an index. Values are converted by the column affinity first, like the comparison does. (e.g. '5'
+// becomes 5 for an INTEGER column) `sourceName` is what qualified columns refer to the table by; its alias or its name.
+func (t *DBTable) columnConstraints(where sql.Expr, sourceName string) map[string]*columnConstraint {
+	constraints := map[string]*columnConstraint{}
+	constraintOf := func(ci int) *columnConstraint {
+		colName := t.columnName(ci)
+		if constraints[colName] == nil {
+			constraints[colName] = &columnConstraint{collation: t.columnCollation(ci)}
+		}
+		return constraints[colName]
+	}
+	for _, term := range conjuncts(where) {
+		expr, ok := term.(*sql.BinaryExpr)
+		if !ok {
+			continue
+		}
+		switch expr.Op {
+		case sql.EQ, sql.LT, sql.LE, sql.GT, sql.GE:
+			op := expr.Op
+			ci, value, ok := t.columnAndLiteral(sourceName, expr.X, expr.Y)
+			if !ok {
+				// `literal < column` is `column > literal`
+				op = flipComparison(op)
+				if ci, value, ok = t.columnAndLiteral(sourceName, expr.Y, expr.X); !ok {
+					continue
+				}
+			}
+			c := constraintOf(ci)
+			switch op {
+			case sql.EQ:
+				if c.values == nil {
+					c.values = []btree.Value{value}
+				}
+			case sql.GT, sql.GE:
+				c.tightenLower(&indexBound{value: value, inclusive: op == sql.GE})
+			case sql.LT, sql.LE:
+				c.tightenUpper(&indexBound{value: value, inclusive: op == sql.LE})
+			}
+		case sql.BETWEEN:
+			rng, ok := expr.Y.(*sql.Range)
+			if !ok {
+				continue
+			}
+			ci, lower, ok := t.columnAndLiteral(sourceName, expr.X, rng.X)
+			if !ok {
+				continue
+			}
+			_, upper, ok := t.columnAndLiteral(sourceName, expr.X, rng.Y)
+			if !ok {
+				continue
+			}
+			c := constraintOf(ci)
+			c.tightenLower(&indexBound{value: lower, inclusive: true})
+			c.tightenUpper(&indexBound{value: upper, inclusive: true})
+		case sql.IN:
+			list, ok := expr.Y.(*sql.ExprList)
+			if !ok || len(list.Exprs) == 0 {
+				continue
+			}
+			ci := -1
+			values := make([]btree.Value, 0, len(list.Exprs))
+			for _, item := range list.Exprs {
+				itemColumn, value, ok := t.columnAndLiteral(sourceName, expr.X, item)
+				if !ok {
+					ci = -1
+					break
+				}
+				ci = itemColumn
+				values = append(values, value)
+			}
+			if ci < 0 {
+				continue
+			}
+			if c := constraintOf(ci); c.values == nil {
+				c.values = distinctSorted(values)
+			}
+		}
+	}
+	return constraints
+}
+
+// The column (of this table) and the literal of `column op literal`, the literal converted by the column affinity.
+// False when the operands are not of that shape, or the literal can never compare true. (NULL, or not an integer for the rowid)
+func (t *DBTable) columnAndLiteral(sourceName string, columnExpr sql.Expr, literalExpr sql.Expr) (int, btree.Value, bool) {
+	var colName string
+	switch col := columnExpr.(type) {
+	case *sql.Ident:
+		colName = col.Name
+	case *sql.QualifiedRef:
+		if col.Column == nil || !strings.EqualFold(col.Table.Name, sourceName) {
+			return -1, btree.Value{}, false
+		}
+		colName = col.Column.Name
+	default:
+		return -1, btree.Value{}, false
+	}
+	ci, ok := t.ColumnIndex(colName)
+	if !ok {
+		return -1, btree.Value{}, false
+	}
+	negative := false
+	if unary, ok := literalExpr.(*sql.UnaryExpr); ok && unary.Op == sql.MINUS {
+		negative, literalExpr = true, unary.X
+	}
+	var value btree.Value
+	switch lit := literalExpr.(type) {
+	case *sql.StringLit:
+		if negative {
+			return -1, btree.Value{}, false
+		}
+		value = btree.TextValue(lit.Value)
+	case *sql.NumberLit:
+		v, err := numberLiteral(lit.Value)
+		if negative {
+			v, err = negativeNumberLiteral(lit.Value)
+		}
+		if err != nil {
+			return -1, btree.Value{}, false
+		}
+		value = v
+	default:
+		return -1, btree.Value{}, false
+	}
+	value = value.ApplyAffinity(t.columnAffinity(ci))
+	if t.isRowid(ci) && value.Class() != btree.IntegerClass {
+		// never equal to any rowid.
+		return -1, btree.Value{}, false
+	}
+	return ci, value, true
+}
+
+func flipComparison(op sql.Token) sql.Token {
+	switch op {
+	case sql.LT:
+		return sql.GT
+	case sql.LE:
+		return sql.GE
+	case sql.GT:
+		return sql.LT
+	case sql.GE:
+		return sql.LE
+	}
+	return op
+}
+
+// Keep the higher lower bound.
+func (c *columnConstraint) tightenLower(bound *indexBound) {
+	if c.lower == nil {
+		c.lower = bound
+		return
+	}
+	if cmp := btree.CompareCollated(bound.value, c.lower.value, c.collation); cmp > 0 || (cmp == 0 && !bound.inclusive) {
+		c.lower = bound
+	}
+}
+
+// Keep the lower upper bound.
+func (c *columnConstraint) tightenUpper(bound *indexBound) {
+	if c.upper == nil {
+		c.upper = bound
+		return
+	}
+	if cmp := btree.CompareCollated(bound.value, c.upper.value, c.collation); cmp < 0 || (cmp == 0 && !bound.inclusive) {
+		c.upper = bound
+	}
+}
+
+func distinctSorted(values []btree.Value) []btree.Value {
+	sort.Slice(values, func(i, j int) bool {
+		return btree.Compare(values[i], values[j]) < 0
+	})
+	distinct := values[:0]
+	for i, v := range values {
+		if i == 0 || btree.Compare(v, values[i-1]) != 0 {
+			distinct = append(distinct, v)
+		}
+	}
+	return distinct
+}
+
+// Rowids to look up from the rowid alias' = or IN term, if there is one.
+func (t *DBTable) rowidLookup(where map[string]*columnConstraint) ([]int64, bool) {
+	c, ok := where[t.rowIdAliasName()]
+	if !ok || c.values == nil {
+		return nil, false
+	}
+	rowIds := make([]int64, len(c.values))
+	for i, v := range c.values {
+		rowIds[i] = v.Integer()
+	}
+	return rowIds, true
+}
+
+// Name of the rowid; its alias, or the first of ROWID_NAMES no column has. (empty when all of them are taken)
+func (t *DBTable) rowIdAliasName() string {
+	if t.rowIdAliasColIndex >= 0 {
+		return t.tableSpec.Columns[t.rowIdAliasColIndex].Name
+	}
+	for _, name := range ROWID_NAMES {
+		if ci, _ := t.ColumnIndex(name); ci == ROWID_COLUMN {
+			return name
+		}
+	}
+	return ""
+}
+
+// Number of rowids looked up at once when reading rows in index order.
+const INDEX_LOOKUP_BATCH = 256
+
+// Rows of the index entries in that same order, looked up a batch of entries at a time; by rowid, or by the PRIMARY
+// KEY at the end of the entries of a WITHOUT ROWID table. Entries are read only as the rows are wanted.
+type indexOrderedRows struct {
+	table   *DBTable
+	index   *DBIndex
+	entries entryIterator
+	batch   []Row
+	err     error
+}
+
+func (r *indexOrderedRows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if len(r.batch) > 1 {
+		r.batch = r.batch[1:]
+		return true
+	}
+	r.batch = nil
+	for len(r.batch) == 0 {
+		var wanted [][]btree.TableBTreeLeafPageCellField
+		for len(wanted) < INDEX_LOOKUP_BATCH && r.entries.Next() {
+			wanted = append(wanted, r.entries.Entry())
+		}
+		if err := r.entries.Err(); err != nil {
+			r.err = err
+			return false
+		}
+		if len(wanted) == 0 {
+			return false
+		}
+		if r.batch, r.err = r.lookup(wanted); r.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// The rows of the entries in their order, the ones that do not exist are left out.
+func (r *indexOrderedRows) lookup(entries [][]btree.TableBTreeLeafPageCellField) ([]Row, error) {
+	if r.index.withoutRowid {
+		pk := r.table.primaryKey
+		found, err := pk.SeekEntries(r.index.primaryKeySeeks(pk, entries))
+		if err != nil {
+			return nil, err
+		}
+		rows := newCoveringRows(r.table, pk, &sliceEntries{entries: found})
+		var out []Row
+		for rows.Next() {
+			out = append(out, rows.Row())
+		}
+		return out, nil
+	}
+	wanted := make([]int64, len(entries))
+	for e, fields := range entries {
+		rowid, err := r.index.entryRowid(fields)
+		if err != nil {
+			return nil, err
+		}
+		wanted[e] = rowid
+	}
+	// SelectRowsByIds sorts what it is given; keep our order intact.
+	found, err := r.table.SelectRowsByIds(append([]int64{}, wanted...))
+	if err != nil {
+		return nil, err
+	}
+	byRowid := make(map[int64]Row, len(found))
+	for _, row := range found {
+		byRowid[row.Rowid()] = row
+	}
+	var out []Row
+	for _, rowid := range wanted {
+		if row, ok := byRowid[rowid]; ok {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+func (r *indexOrderedRows) Row() Row {
+	return r.batch[0]
+}
+
+func (r *indexOrderedRows) Err() error {
+	return r.err
+}
+
+func (r *indexOrderedRows) Close() error {
+	r.batch = nil
+	return r.entries.Close()
+}
+
+// Rows of the rowids in rowid order, the ones that do not exist are left out. (rowIds gets sorted)
+func (t *DBTable) SelectRowsByIds(rowIds []int64) ([]Row, error) {
+	out := []Row{}
+	if len(rowIds) == 0 {
+		return out, nil
+	}
+	start := time.Now()
+	sl := NewSearchList(rowIds)
+	err := walkThroughBTreeForRowId(t.db, int64(t.rootPage), sl, t.rowIdAliasColIndex, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, cell := range sl.result {
+		if cell != nil {
+			out = append(out, Row{
+				cell:  cell,
+				table: t,
+			})
+		}
+	}
+	elapsed := time.Since(start)
+	debugf("search for %d rowid Elapsed time: %s\n", len(rowIds), elapsed)
+	return out, nil
+}
+
+// Check the row against the WHERE clause, NULL counts as false.
+func (t *DBTable) applyFilter(predicate evaluator, row Row) (bool, error) {
+	v, err := predicate(&evalEnv{rows: []Row{row}})
+	if err != nil {
+		return false, err
+	}
+	isTrue, _ := truth(v)
+	return isTrue, nil
+}
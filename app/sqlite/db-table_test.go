@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// The values sqlite3 gives columns added by ALTER TABLE ADD COLUMN in rows written before; `quote(column)`.
+func TestColumnDefaults(t *testing.T) {
+	spec, err := ParseCreateTable(`CREATE TABLE t(a, b int default '7', c real default 3, d text default 5, e default (-2),
+		f default x'41', g default 'x''y', h default null, i text collate nocase default 'Q', k default true,
+		l default -3.5, m default +4, n default CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatalf("ParseCreateTable failed: %v", err)
+	}
+	want := []string{"NULL", "7", "3.0", "'5'", "-2", "X'41'", "'x''y'", "NULL", "'Q'", "1", "-3.5", "4", "NULL"}
+	defaults := columnDefaults(spec)
+	if len(defaults) != len(want) {
+		t.Fatalf("%d defaults, want %d", len(defaults), len(want))
+	}
+	for ci, v := range defaults {
+		if got := quoteValue(v); got != want[ci] {
+			t.Errorf("DEFAULT of %s = %s, want %s", spec.Columns[ci].Name, got, want[ci])
+		}
+	}
+}
+
+// Records leave out VIRTUAL generated columns, STORED ones are in them.
+func TestVirtualColumns(t *testing.T) {
+	spec, err := ParseCreateTable(`CREATE TABLE g(a int, b as (a*2), c text generated always as (upper(d)) stored, d text,
+		e real as (a + 0.5) virtual, f as (no_such_function(a)))`)
+	if err != nil {
+		t.Fatalf("ParseCreateTable failed: %v", err)
+	}
+	tbl, err := NewDBTable(nil, &Schema{name: "g"}, spec)
+	if err != nil {
+		t.Fatalf("NewDBTable failed: %v", err)
+	}
+	want := []int{0, -1, 1, 2, -1, -1}
+	for ci, field := range tbl.recordFields {
+		if field != want[ci] {
+			t.Errorf("column %s is field %d, want %d", spec.Columns[ci].Name, field, want[ci])
+		}
+	}
+	row := materializedRow(tbl, 1, []btree.Value{btree.IntegerValue(3), {}, btree.TextValue("X"), btree.TextValue("x")})
+	if got := quoteValue(row.Column(1)); got != "6" {
+		t.Errorf("b = %s, want 6", got)
+	}
+	if got := quoteValue(row.Column(4)); got != "3.5" {
+		t.Errorf("e = %s, want 3.5", got)
+	}
+	if tbl.columnError(1) != nil || tbl.columnError(5) == nil {
+		t.Errorf("only f should fail to be computed: %v, %v", tbl.columnError(1), tbl.columnError(5))
+	}
+}
@@ -0,0 +1,199 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// A view; its SELECT runs as a subquery of the queries that read from it, unless it can be flattened into them.
+// (see flattenView)
+type DBView struct {
+	Schema
+	viewSpec    *sql.CreateViewStatement
+	columnTexts []string // result columns of the SELECT as written, see selectListText()
+}
+
+func NewDBView(schema *Schema, viewSpec *sql.CreateViewStatement) *DBView {
+	debugf("View Spec: %s %d columns\n", viewSpec.Name.Name, len(viewSpec.Select.Columns))
+	return &DBView{
+		Schema:      *schema,
+		viewSpec:    viewSpec,
+		columnTexts: selectListText(viewSelectText(schema.sql)),
+	}
+}
+
+func (v *DBView) Name() string {
+	return v.viewSpec.Name.Name
+}
+
+// The SELECT of `CREATE VIEW v(a, b) AS SELECT ...`, what follows the first AS outside of quotes and parentheses.
+func viewSelectText(sqlText string) string {
+	text := []rune(sqlText)
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == '\'' || ch == '"' || ch == '`' || ch == '[':
+			i = skipQuoted(text, i) - 1
+		case ch == '-' && i+1 < len(text) && text[i+1] == '-', ch == '/' && i+1 < len(text) && text[i+1] == '*':
+			i = skipSpaceAndComments(text, i) - 1
+		case unicode.IsLetter(ch) || ch == '_':
+			word, end := wordAt(text, i)
+			if depth == 0 && strings.EqualFold(word, "as") {
+				return string(text[end:])
+			}
+			i = end - 1
+		}
+	}
+	return ""
+}
+
+// A table made of the rows of a view, for one query to read from. As the first table its rows are read as the
+// SELECT produces them; a view read again for every row of a join runs it once, the first time. (see materializeView)
+func (d *Db) viewTable(v *DBView) (*DBTable, error) {
+	if d.expanding[v.Name()] {
+		return nil, fmt.Errorf("view %s is circularly defined", v.Name())
+	}
+	d.expanding[v.Name()] = true
+	defer delete(d.expanding, v.Name())
+
+	columns, err := d.viewColumns(v)
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := NewDBTable(d, &v.Schema, &TableSpec{Name: v.Name(), Columns: columns})
+	if err != nil {
+		return nil, err
+	}
+	tbl.view = v
+	return tbl, nil
+}
+
+// Columns of the view: named by its column list, or like the result columns of its SELECT. A name that is
+// already taken gets a number, e.g. `id:1`. Column references keep their affinity and collation, other expressions
+// have none.
+func (d *Db) viewColumns(v *DBView) ([]ColumnSpec, error) {
+	selectStmt := v.viewSpec.Select
+	var sources []sourceTable
+	if selectStmt.Source != nil {
+		var err error
+		if sources, _, err = d.fromSources(selectStmt.Source); err != nil {
+			return nil, err
+		}
+	}
+	sc := &scope{sources: sources, aggregates: &aggregateSet{sources: len(sources)}, aliases: resultAliases(selectStmt.Columns)}
+	results, names, err := compileResultColumns(selectStmt.Columns, sc, v.columnTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.viewSpec.Columns) > 0 {
+		if len(v.viewSpec.Columns) != len(names) {
+			return nil, fmt.Errorf("expected %d columns for '%s' but got %d", len(v.viewSpec.Columns), v.Name(), len(names))
+		}
+		for c, col := range v.viewSpec.Columns {
+			names[c] = col.Name
+		}
+	}
+	columns := make([]ColumnSpec, len(names))
+	taken := map[string]bool{}
+	for c, name := range names {
+		unique := name
+		for n := 1; taken[strings.ToLower(unique)]; n++ {
+			unique = fmt.Sprintf("%s:%d", name, n)
+		}
+		taken[strings.ToLower(unique)] = true
+		columns[c] = ColumnSpec{Name: unique, Affinity: results[c].affinity}
+		if collation := results[c].collation; collation != "BINARY" {
+			columns[c].Constraints = []Constraint{{Kind: CollateConstraint, SQL: "COLLATE " + collation, Collation: collation}}
+		}
+	}
+	return columns, nil
+}
+
+// Rows of the view as its SELECT produces them, nothing is kept.
+func (t *DBTable) streamView() (rowIterator, error) {
+	rows, err := t.db.selectRows(t.view.viewSpec.Select, t.view.columnTexts)
+	if err != nil {
+		return nil, err
+	}
+	return &viewRows{table: t, rows: rows}, nil
+}
+
+// The result rows of a view's SELECT as rows of the view, numbered from 1.
+type viewRows struct {
+	table *DBTable
+	rows  *Rows
+	row   Row
+	count int64
+}
+
+func (v *viewRows) Next() bool {
+	if !v.rows.Next() {
+		return false
+	}
+	v.count++
+	v.row = materializedRow(v.table, v.count, append([]btree.Value{}, v.rows.Values()...))
+	return true
+}
+
+func (v *viewRows) Row() Row {
+	return v.row
+}
+
+func (v *viewRows) Err() error {
+	return v.rows.Err()
+}
+
+func (v *viewRows) Close() error {
+	return v.rows.Close()
+}
+
+// Rows of the view, its SELECT is run the first time. For the inner side of a join, read again for every outer row.
+func (t *DBTable) materializeView() ([]Row, error) {
+	if t.materialized != nil {
+		return t.materialized, nil
+	}
+	rows, err := t.streamView()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	materialized := []Row{}
+	for rows.Next() {
+		materialized = append(materialized, rows.Row())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	debugf("View %s materialized %d rows\n", t.view.Name(), len(materialized))
+	t.materialized = materialized
+	return materialized, nil
+}
+
+// Steps of the views the join reads, before the join's own. Like sqlite3 the first table is a co-routine,
+// read as it goes (see firstRows), others are materialized.
+func (d *Db) explainViews(plan *joinPlan, explain *queryPlan) error {
+	for si, src := range plan.sources {
+		if src.table.view == nil {
+			continue
+		}
+		how := "MATERIALIZE "
+		if si == 0 {
+			how = "CO-ROUTINE "
+		}
+		err := explain.nest(how+src.table.view.Name(), func() error {
+			return d.explainSelect(src.table.view.viewSpec.Select, src.table.view.columnTexts, explain)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+const HEADER_SIZE = 100
+
+// The object the represent the whole file.
+type Db struct {
+	header       *DatabaseHeader
+	pageSize     uint32
+	schemas      []*Schema           // should be indices by type (e.g. indices, triggers, views).
+	schemaSize   int                 // total length of the SQL text in sqlite_schema
+	tables       map[string]*DBTable // by lower cased name, names are not case sensitive.
+	views        map[string]*DBView
+	schemaTables map[string]*DBTable // sqlite_schema and the names it goes by, lower cased. see SCHEMA_TABLE_NAMES
+	expanding    map[string]bool     // names of the views being expanded, see viewTable()
+	indices      []*DBIndex
+	file         *os.File
+	fileSize     int64      // bytes, when opened.
+	cacheSize    int        // as configured; positive = pages, negative = KiB.
+	pageCache    *pageCache // recently used pages (parsed)
+	sortMemory   int        // bytes an ORDER BY may buffer before spilling to temporary files
+}
+
+// Settings used when opening a database.
+type Options struct {
+	// Same meaning as PRAGMA cache_size: positive is the number of pages, negative is the size in KiB.
+	// 0 uses the size suggested by the database header, or DEFAULT_CACHE_SIZE.
+	CacheSize int
+	// Bytes of rows a sort keeps in memory before spilling sorted runs to temporary files. 0 means DEFAULT_SORT_MEMORY.
+	SortMemory int
+}
+
+func NewDb(databaseFilePath string) (*Db, error) {
+	return NewDbWithOptions(databaseFilePath, Options{})
+}
+
+func NewDbWithOptions(databaseFilePath string, options Options) (*Db, error) {
+	databaseFile, err := os.Open(databaseFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIO, err)
+	}
+	db, err := openDb(databaseFile, options)
+	if err != nil {
+		databaseFile.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openDb(databaseFile *os.File, options Options) (*Db, error) {
+	rawHeader := make([]byte, HEADER_SIZE)
+
+	_, err := io.ReadFull(databaseFile, rawHeader) // read equal to its size
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, newPageError(ErrNotADatabase, 1, 0, err)
+	} else if err != nil {
+		return nil, newPageError(ErrIO, 1, 0, err)
+	}
+
+	header, err := ParseDatabaseHeader(rawHeader)
+	if err != nil {
+		return nil, err
+	}
+	info, err := databaseFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIO, err)
+	}
+	pageSize := header.PageSize
+	// You can use print statements as follows for debugging, they'll be visible when running tests.
+
+	// Parse first page for items
+	pageContent := make([]byte, pageSize-HEADER_SIZE) // first page offset by 100
+	_, err = databaseFile.ReadAt(pageContent, HEADER_SIZE)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the file ends within the first page.
+		return nil, newPageError(ErrCorrupt, 1, HEADER_SIZE, fmt.Errorf("page is beyond the end of file: %w", err))
+	} else if err != nil {
+		return nil, newPageError(ErrIO, 1, HEADER_SIZE, err)
+	}
+	cacheSize := options.CacheSize
+	if cacheSize == 0 {
+		cacheSize = DEFAULT_CACHE_SIZE
+		if suggested := int32(header.DefaultCacheSize); suggested > 0 {
+			cacheSize = int(suggested)
+		}
+	}
+	tables := map[string]*DBTable{}
+	db := Db{
+		header:       header,
+		pageSize:     pageSize,
+		tables:       tables,
+		views:        map[string]*DBView{},
+		schemaTables: map[string]*DBTable{},
+		expanding:    map[string]bool{},
+		file:         databaseFile,
+		fileSize:     info.Size(),
+		cacheSize:    cacheSize,
+		pageCache:    newPageCache(cacheSizeInPages(cacheSize, pageSize)),
+		sortMemory:   options.SortMemory,
+	}
+	btreePage, err := btree.ParseBTreePage(pageContent, true, &db)
+	if err != nil {
+		return nil, db.pageError(1, err)
+	}
+	schemas := make([]*Schema, len(btreePage.CellOffsets))
+	db.schemas = schemas
+
+	for row := range (*btreePage).CellOffsets {
+		cell, err := btreePage.ReadTableLeafCell(row, 0)
+		if err != nil {
+			return nil, db.pageError(1, err)
+		}
+		sch, err := NewSchema(cell)
+		if err != nil {
+			return nil, newPageError(ErrCorrupt, 1, int64(btreePage.CellOffsets[row])+HEADER_SIZE, err)
+		}
+		schemas[row] = sch
+		db.schemaSize += utf8.RuneCountInString(cell.Fields[4].Text())
+
+		// additional initialization beyond reading simple schema record.
+		if sch.schemaType == Table {
+			// scanned ourselves, see TableSpec.
+			tableSpec, err := ParseCreateTable(sch.sql)
+			if errors.Is(err, errNotCreateTable) {
+				return nil, fmt.Errorf("%w: Invalid SQL statement: %s. Expected different SQL for %s type", ErrCorrupt, sch.sql, sch.schemaType)
+			}
+			if err != nil {
+				debugf("skipping %s %s: %s\n", sch.schemaType, sch.name, err)
+				continue
+			}
+			tbl, err := NewDBTable(&db, sch, tableSpec)
+			if err != nil {
+				return nil, err
+			}
+			tables[strings.ToLower(sch.name)] = tbl
+			continue
+		}
+		sqlText := sch.sql
+		if sch.schemaType == View {
+			// the SELECT may refer to the rowid, like a query does.
+			sqlText = quoteKeywordNames(sqlText)
+		}
+		stmt, err := sql.NewParser(strings.NewReader(sqlText)).ParseStatement()
+		if err != nil {
+			debugf("skipping %s %s: %s\n", sch.schemaType, sch.name, err)
+			continue
+		}
+		switch stmt.(type) {
+		case *sql.CreateTableStatement:
+			return nil, fmt.Errorf("%w: Invalid SQL statement: %s. Expected different SQL for %s type", ErrCorrupt, sch.sql, sch.schemaType)
+		case *sql.CreateIndexStatement:
+			if sch.schemaType != Index {
+				return nil, fmt.Errorf("%w: Invalid SQL statement: %s. Expected different SQL for %s type", ErrCorrupt, sch.sql, sch.schemaType)
+			}
+			indexSpec := stmt.(*sql.CreateIndexStatement)
+			// tbl_name is the table's name as created, CREATE INDEX may spell it in another case.
+			targetTbl, ok := tables[strings.ToLower(sch.tblName)]
+			if !ok {
+				return nil, fmt.Errorf("%w: Index %s cannot be registered to unknown table %s", ErrCorrupt, indexSpec.Name.Name, sch.tblName)
+			}
+			// Create new Index
+			idx := NewDbIndex(&db, sch, indexSpec, targetTbl)
+			targetTbl.assocIndices = append(targetTbl.assocIndices, idx)
+		case *sql.CreateViewStatement:
+			if sch.schemaType != View {
+				return nil, fmt.Errorf("%w: Invalid SQL statement: %s. Expected different SQL for %s type", ErrCorrupt, sch.sql, sch.schemaType)
+			}
+			// like the schema tables, keyed lower-cased; view names are not case sensitive.
+			db.views[strings.ToLower(sch.name)] = NewDBView(sch, stmt.(*sql.CreateViewStatement))
+		}
+	}
+
+	for _, name := range SCHEMA_TABLE_NAMES {
+		if err := db.addSchemaTable(name, 1); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range TEMP_SCHEMA_TABLE_NAMES {
+		if err := db.addSchemaTable(name, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return &db, nil
+}
+
+// Names sqlite_schema can be queried by; it is the table b-tree of page 1.
+var SCHEMA_TABLE_NAMES = []string{"sqlite_schema", "sqlite_master"}
+
+// Names of the schema of temporary objects; a connection that only reads has none, the table is empty.
+var TEMP_SCHEMA_TABLE_NAMES = []string{"sqlite_temp_schema", "sqlite_temp_master"}
+
+const SCHEMA_TABLE_SQL = "CREATE TABLE sqlite_schema(type text, name text, tbl_name text, rootpage integer, sql text)"
+
+// Register a read-only table of the schema; rootPage 0 has no rows.
+func (d *Db) addSchemaTable(name string, rootPage int64) error {
+	tableSpec, err := ParseCreateTable(SCHEMA_TABLE_SQL)
+	if err != nil {
+		return err
+	}
+	tableSpec.Name = name
+	sch := &Schema{schemaType: Table, name: name, tblName: name, sql: SCHEMA_TABLE_SQL, rootPage: rootPage}
+	tbl, err := NewDBTable(d, sch, tableSpec)
+	if err != nil {
+		return err
+	}
+	d.schemaTables[name] = tbl
+	return nil
+}
+
+func (d *Db) Close() error {
+	return d.file.Close()
+}
+
+func (d *Db) Header() *DatabaseHeader {
+	return d.header
+}
+
+// All rows of sqlite_schema in their stored order.
+func (d *Db) Schemas() []*Schema {
+	return d.schemas
+}
+
+// Total length of the SQL text in sqlite_schema.
+func (d *Db) SchemaSize() int {
+	return d.schemaSize
+}
+
+// All tables sorted by name.
+func (d *Db) Tables() []*DBTable {
+	out := make([]*DBTable, 0, len(d.tables))
+	for _, tbl := range d.tables {
+		out = append(out, tbl)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name() < out[j].Name()
+	})
+	return out
+}
+
+// The table of given name, or one of the schema tables. (e.g. sqlite_master, in any case)
+func (d *Db) Table(name string) (*DBTable, bool) {
+	if tbl, ok := d.tables[strings.ToLower(name)]; ok {
+		return tbl, true
+	}
+	tbl, ok := d.schemaTables[strings.ToLower(name)]
+	return tbl, ok
+}
+
+// All views sorted by name.
+func (d *Db) Views() []*DBView {
+	out := make([]*DBView, 0, len(d.views))
+	for _, view := range d.views {
+		out = append(out, view)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name() < out[j].Name()
+	})
+	return out
+}
+
+func (d *Db) View(name string) (*DBView, bool) {
+	view, ok := d.views[strings.ToLower(name)]
+	return view, ok
+}
+
+// Number of schema objects of given type. (e.g. tables, indices)
+func (d *Db) CountSchemas(schemaType SchemaType) int {
+	count := 0
+	for _, sch := range d.schemas {
+		if sch.schemaType == schemaType {
+			count++
+		}
+	}
+	return count
+}
+
+// The cache_size setting in effect. (see Options.CacheSize)
+func (d *Db) CacheSize() int {
+	return d.cacheSize
+}
+
+// Change the page cache size; same meaning as Options.CacheSize except 0 disables the cache.
+func (d *Db) SetCacheSize(cacheSize int) {
+	d.cacheSize = cacheSize
+	d.pageCache.resize(cacheSizeInPages(cacheSize, d.pageSize))
+}
+
+func (d *Db) CacheStats() CacheStats {
+	return d.pageCache.snapshot()
+}
+
+// @param pageIndex = pageNo - 1
+func (d *Db) readPage(pageIndex int64) (*btree.TableBTreePage, error) {
+	cached, ok := d.pageCache.get(pageIndex)
+	if ok {
+		return cached, nil
+	}
+	if pageIndex < 0 {
+		return nil, newPageError(ErrCorrupt, pageIndex+1, 0, fmt.Errorf("invalid page number"))
+	}
+	pageContent := make([]byte, d.pageSize)
+	_, err := d.file.ReadAt(pageContent, int64(d.pageSize)*pageIndex)
+	if err == io.EOF {
+		return nil, newPageError(ErrCorrupt, pageIndex+1, 0, fmt.Errorf("page is beyond the end of file: %w", err))
+	} else if err != nil {
+		return nil, newPageError(ErrIO, pageIndex+1, 0, err)
+	}
+	// debugf("reading page (index) %d\n", pageIndex)
+	var btreePage *btree.TableBTreePage
+	if pageIndex == 0 {
+		// the root of sqlite_schema, after the database header.
+		btreePage, err = btree.ParseBTreePage(pageContent[HEADER_SIZE:], true, d)
+	} else {
+		btreePage, err = btree.ParseBTreePage(pageContent, false, d)
+	}
+	if err != nil {
+		return nil, d.pageError(pageIndex+1, err)
+	}
+	// cache it.
+	d.pageCache.put(pageIndex, btreePage)
+	return btreePage, nil
+}
+
+// The number of bytes of each page that can hold content. (btree.Pager)
+func (d *Db) UsableSize() int {
+	return d.header.UsableSize()
+}
+
+// The size of the database file as it was opened. (btree.Pager)
+func (d *Db) DatabaseSize() int64 {
+	return d.fileSize
+}
+
+// Read the page as is, bypassing the page cache. Used for overflow pages. (btree.Pager)
+func (d *Db) ReadRawPage(pageNumber uint32) ([]byte, error) {
+	if pageNumber < 1 {
+		return nil, newPageError(ErrCorrupt, int64(pageNumber), 0, fmt.Errorf("invalid page number"))
+	}
+	pageContent := make([]byte, d.pageSize)
+	_, err := d.file.ReadAt(pageContent, int64(d.pageSize)*int64(pageNumber-1))
+	if err == io.EOF {
+		return nil, newPageError(ErrCorrupt, int64(pageNumber), 0, fmt.Errorf("page is beyond the end of file: %w", err))
+	} else if err != nil {
+		return nil, newPageError(ErrIO, int64(pageNumber), 0, err)
+	}
+	return pageContent, nil
+}
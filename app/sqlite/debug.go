@@ -0,0 +1,13 @@
+package sqlite
+
+import (
+	"fmt"
+	"io"
+)
+
+// Where the "[dbg]" traces go. Silent by default; the CLI points this to os.Stderr.
+var DebugOutput io.Writer = io.Discard
+
+func debugf(format string, args ...any) {
+	fmt.Fprintf(DebugOutput, "[dbg] "+format, args...)
+}
@@ -0,0 +1,59 @@
+package sqlite
+
+import "github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+
+// The result columns as keys of SELECT DISTINCT, rows equal in all of them are the same.
+func distinctKeys(results []resultColumn) []orderingKey {
+	keys := make([]orderingKey, len(results))
+	for i, result := range results {
+		keys[i] = orderingKey{eval: result.eval, column: result.column, nullsFirst: true, collation: result.collation}
+	}
+	return keys
+}
+
+// Whether the keys include the rowid of the only table; every row is distinct then.
+func (p *joinPlan) rowidDistinct(keys []orderingKey) bool {
+	if len(p.sources) != 1 {
+		return false
+	}
+	for _, key := range keys {
+		if p.sources[0].table.isRowid(key.column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drop the rows equal to one before, TEXT compared by the collation of the keys. With `ordered` equal rows come one
+// after the other and only the previous row is kept to compare with, otherwise the key of every distinct row is.
+func distinctRows(rows *Rows, keys []orderingKey, ordered bool) *Rows {
+	next := rows.next
+	var collations []string
+	for _, key := range keys {
+		collations = append(collations, key.collation)
+	}
+	seen := map[string]bool{}
+	var previous []btree.Value
+	rows.next = func() ([]btree.Value, bool, error) {
+		for {
+			values, ok, err := next()
+			if !ok || err != nil {
+				return values, ok, err
+			}
+			if ordered {
+				if previous != nil && sameKey(keys, previous, values) {
+					continue
+				}
+				previous = append(previous[:0], values...)
+				return values, true, nil
+			}
+			key := valuesKey(values, collations)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			return values, true, nil
+		}
+	}
+	return rows
+}
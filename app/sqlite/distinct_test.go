@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+func TestDistinctRows(t *testing.T) {
+	cases := []struct {
+		collation string
+		ordered   bool
+		rows      []string // SQL literals, one column
+		want      string   // quoted, comma separated
+	}{
+		{"BINARY", false, []string{"1", "'a'", "1.0", "NULL", "'a'", "NULL", "2"}, "1,'a',NULL,2"},
+		{"NOCASE", false, []string{"'b'", "'A'", "'a'", "'B'", "'c'"}, "'b','A','c'"},
+		{"RTRIM", false, []string{"'a'", "'a  '", "' a'"}, "'a',' a'"},
+		{"BINARY", true, []string{"NULL", "NULL", "1", "1", "'a'", "'a'", "'b'"}, "NULL,1,'a','b'"},
+		{"NOCASE", true, []string{"'A'", "'a'", "'b'", "'B'", "'b'"}, "'A','b'"},
+	}
+	for _, c := range cases {
+		values := append([]string{}, c.rows...)
+		rows := &Rows{
+			columns: []string{"x"},
+			next: func() ([]btree.Value, bool, error) {
+				if len(values) == 0 {
+					return nil, false, nil
+				}
+				v := literalValue(t, values[0])
+				values = values[1:]
+				return []btree.Value{v}, true, nil
+			},
+		}
+		rows = distinctRows(rows, []orderingKey{{column: -1, collation: c.collation}}, c.ordered)
+		var got []string
+		for rows.Next() {
+			got = append(got, quoteValue(rows.Values()[0]))
+		}
+		if rows.Err() != nil {
+			t.Fatalf("distinct rows failed: %v", rows.Err())
+		}
+		if strings.Join(got, ",") != c.want {
+			t.Errorf("DISTINCT %v (%s, ordered=%v) = %s, want %s", c.rows, c.collation, c.ordered, strings.Join(got, ","), c.want)
+		}
+	}
+}
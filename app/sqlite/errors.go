@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// Kinds of errors returned by the engine. Test with errors.Is(err, ErrCorrupt).
+var (
+	ErrCorrupt      = errors.New("database disk image is malformed")
+	ErrNotADatabase = errors.New("file is not a database")
+	ErrUnsupported  = errors.New("unsupported database feature")
+	ErrIO           = errors.New("disk I/O error")
+)
+
+// An error at a specific location of the database file.
+type PageError struct {
+	Kind   error // ErrCorrupt, ErrNotADatabase, ErrUnsupported or ErrIO
+	Page   int64 // page number (starts from 1)
+	Offset int64 // byte offset within the page
+	Err    error // the underlying cause
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("%s (page %d, offset %d): %v", e.Kind, e.Page, e.Offset, e.Err)
+}
+
+// Both the kind and the underlying cause are matched by errors.Is / errors.As
+func (e *PageError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+func newPageError(kind error, pageNumber int64, offset int64, err error) error {
+	return &PageError{Kind: kind, Page: pageNumber, Offset: offset, Err: err}
+}
+
+// Locate an error raised while reading given page.
+//
+// Errors that are already located (e.g. from an overflow page) are returned as is; malformed content
+// found by the btree package becomes ErrCorrupt at the reported offset.
+func (d *Db) pageError(pageNumber int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	var located *PageError
+	if errors.As(err, &located) {
+		return err
+	}
+	offset := int64(0)
+	var formatErr *btree.FormatError
+	if errors.As(err, &formatErr) {
+		offset = int64(formatErr.Offset)
+		if pageNumber == 1 {
+			// page 1 content is read without the database header.
+			offset += HEADER_SIZE
+		}
+	}
+	return newPageError(ErrCorrupt, pageNumber, offset, err)
+}
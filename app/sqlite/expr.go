@@ -0,0 +1,806 @@
+package sqlite
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// What an expression is evaluated against; the current row of each table in the FROM clause.
+type evalEnv struct {
+	rows       []Row
+	aggregates []btree.Value // results of the aggregate calls of the current group, see aggregateSet
+}
+
+// A compiled expression, see compileExpr().
+type evaluator func(env *evalEnv) (btree.Value, error)
+
+// A table visible to expressions, by its alias (or its name when there is no alias).
+type sourceTable struct {
+	name  string
+	table *DBTable
+	// columns joined by USING or NATURAL to a column of a table before; only reachable by their qualified name.
+	hidden map[int]bool
+	// columns the compiled expressions read, whether an index has all of them. (see accessPath.covering)
+	used map[int]bool
+}
+
+// Tables that column references are resolved against.
+type scope struct {
+	sources []sourceTable
+	// Aggregate calls are collected here; nil where they are not allowed. (e.g. WHERE)
+	aggregates *aggregateSet
+	// Set while compiling the arguments of an aggregate call, which must not be aggregates themselves.
+	aggregateArg string
+	// Result column aliases by lowercased name, used when no column matches.
+	aliases map[string]sql.Expr
+	// When set, the highest index of the sources that compiled columns refer to is kept here.
+	level *int
+}
+
+func (s *scope) withoutAliases() *scope {
+	copied := *s
+	copied.aliases = nil
+	return &copied
+}
+
+// The same scope, keeping track of the last source the compiled expression refers to.
+func (s *scope) recordingLevel(level *int) *scope {
+	copied := *s
+	copied.level = level
+	return &copied
+}
+
+// Locate a column; tableName may be empty. Returns the index within sources and the column index.
+func (s *scope) resolve(tableName string, columnName string) (int, int, error) {
+	found, foundSource, foundColumn := 0, -1, -1
+	for si, src := range s.sources {
+		if tableName != "" && !strings.EqualFold(src.name, tableName) {
+			continue
+		}
+		if ci, ok := src.table.ColumnIndex(columnName); ok && (tableName != "" || !src.hidden[ci]) {
+			found++
+			foundSource, foundColumn = si, ci
+		}
+	}
+	switch {
+	case found > 1:
+		return -1, -1, fmt.Errorf("ambiguous column name: %s", columnName)
+	case found == 0 && tableName != "":
+		return -1, -1, fmt.Errorf("no such column: %s.%s", tableName, columnName)
+	case found == 0:
+		return -1, -1, fmt.Errorf("no such column: %s", columnName)
+	}
+	return foundSource, foundColumn, nil
+}
+
+// Turn the parsed expression into a function of the current row(s), along with the affinity of its result.
+// Columns are resolved once here instead of on every row.
+func compileExpr(expr sql.Expr, sc *scope) (evaluator, btree.Affinity, error) {
+	switch expr := expr.(type) {
+	case *sql.NumberLit:
+		v, err := numberLiteral(expr.Value)
+		if err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+		return constant(v), btree.BlobAffinity, nil
+	case *sql.StringLit:
+		return constant(btree.TextValue(expr.Value)), btree.BlobAffinity, nil
+	case *sql.BlobLit:
+		b, err := hex.DecodeString(expr.Value)
+		if err != nil {
+			return nil, btree.BlobAffinity, fmt.Errorf("malformed blob literal x'%s'", expr.Value)
+		}
+		return constant(btree.BlobValue(b)), btree.BlobAffinity, nil
+	case *sql.NullLit:
+		return constant(btree.NullValue()), btree.BlobAffinity, nil
+	case *sql.BoolLit:
+		if expr.Value {
+			return constant(btree.IntegerValue(1)), btree.BlobAffinity, nil
+		}
+		return constant(btree.IntegerValue(0)), btree.BlobAffinity, nil
+	case *sql.Ident:
+		ev, aff, err := compileColumn(sc, "", expr.Name)
+		if aliased, ok := sc.aliases[strings.ToLower(expr.Name)]; err != nil && ok {
+			// a result column alias; compiled without aliases so `SELECT a+1 AS a` cannot refer to itself.
+			return compileExpr(aliased, sc.withoutAliases())
+		}
+		if err != nil && expr.Quoted && !keywordColumns[strings.ToLower(expr.Name)] {
+			// SQLite treats an unknown "double quoted" identifier as a string literal. (`rowid` is quoted by
+			// quoteKeywordNames, it is not one; a WITHOUT ROWID table has no such column)
+			return constant(btree.TextValue(expr.Name)), btree.BlobAffinity, nil
+		}
+		return ev, aff, err
+	case *sql.QualifiedRef:
+		if expr.Column == nil {
+			return nil, btree.BlobAffinity, fmt.Errorf("%s.* is only allowed as a result column", expr.Table.Name)
+		}
+		return compileColumn(sc, expr.Table.Name, expr.Column.Name)
+	case *sql.ParenExpr:
+		return compileExpr(expr.X, sc)
+	case *sql.ExprList:
+		if len(expr.Exprs) != 1 {
+			return nil, btree.BlobAffinity, fmt.Errorf("row value misused")
+		}
+		return compileExpr(expr.Exprs[0], sc)
+	case *sql.UnaryExpr:
+		return compileUnary(expr, sc)
+	case *sql.BinaryExpr:
+		return compileBinary(expr, sc)
+	case *sql.CastExpr:
+		return compileCast(expr, sc)
+	case *sql.CaseExpr:
+		return compileCase(expr, sc)
+	case *sql.Call:
+		return compileCall(expr, sc)
+	}
+	return nil, btree.BlobAffinity, fmt.Errorf("'%s' expression is not yet supported", expr)
+}
+
+// Function calls; aggregates (see aggregateSet) or the built-in scalar functions. (see scalarFunctions)
+func compileCall(call *sql.Call, sc *scope) (evaluator, btree.Affinity, error) {
+	name := strings.ToLower(call.Name.Name)
+	if factory := aggregateFactory(name, len(call.Args), call.Star.IsValid()); factory != nil {
+		switch {
+		case sc.aggregateArg != "":
+			return nil, btree.BlobAffinity, fmt.Errorf("misuse of aggregate function %s()", name)
+		case sc.aggregates == nil:
+			return nil, btree.BlobAffinity, fmt.Errorf("misuse of aggregate: %s()", name)
+		}
+		rowScope := &scope{sources: sc.sources, aggregateArg: name, aliases: sc.aliases}
+		ev, err := sc.aggregates.add(call, factory, rowScope)
+		return ev, btree.BlobAffinity, err
+	}
+	fn, ok := scalarFunctions[name]
+	if !ok && !isAggregateName(name) {
+		return nil, btree.BlobAffinity, fmt.Errorf("no such function: %s", call.Name.Name)
+	}
+	argc := len(call.Args)
+	if !ok || call.Star.IsValid() || argc < fn.minArgs || (fn.maxArgs >= 0 && argc > fn.maxArgs) {
+		return nil, btree.BlobAffinity, fmt.Errorf("wrong number of arguments to function %s()", name)
+	}
+	if call.Filter != nil {
+		return nil, btree.BlobAffinity, fmt.Errorf("FILTER may not be used with non-aggregate %s()", name)
+	}
+	args := make([]evaluator, argc)
+	for a, arg := range call.Args {
+		ev, _, err := compileExpr(arg, sc)
+		if err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+		args[a] = ev
+	}
+	return func(env *evalEnv) (btree.Value, error) {
+		values := make([]btree.Value, len(args))
+		for a, arg := range args {
+			v, err := arg(env)
+			if err != nil {
+				return v, err
+			}
+			values[a] = v
+		}
+		return fn.call(values)
+	}, btree.BlobAffinity, nil
+}
+
+func constant(v btree.Value) evaluator {
+	return func(env *evalEnv) (btree.Value, error) {
+		return v, nil
+	}
+}
+
+func compileColumn(sc *scope, tableName string, columnName string) (evaluator, btree.Affinity, error) {
+	si, ci, err := sc.resolve(tableName, columnName)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	if err := sc.sources[si].table.columnError(ci); err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	if sc.level != nil && si > *sc.level {
+		*sc.level = si
+	}
+	sc.sources[si].used[ci] = true
+	return func(env *evalEnv) (btree.Value, error) {
+		return env.rows[si].Column(ci), nil
+	}, sc.sources[si].table.columnAffinity(ci), nil
+}
+
+// Integer literal, or real when it has a fraction/exponent or does not fit 64 bits.
+func numberLiteral(lit string) (btree.Value, error) {
+	if !strings.ContainsAny(lit, ".eE") {
+		if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			return btree.IntegerValue(i), nil
+		}
+	}
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil && !math.IsInf(f, 0) {
+		return btree.Value{}, fmt.Errorf("malformed number %s", lit)
+	}
+	return btree.RealValue(f), nil
+}
+
+// The value of the literal negated. Like sqlite3 -9223372036854775808 is the smallest integer, even though
+// 9223372036854775808 alone is too big for one.
+func negativeNumberLiteral(lit string) (btree.Value, error) {
+	if !strings.ContainsAny(lit, ".eE") {
+		if i, err := strconv.ParseInt("-"+lit, 10, 64); err == nil {
+			return btree.IntegerValue(i), nil
+		}
+	}
+	v, err := numberLiteral(lit)
+	if err != nil {
+		return btree.Value{}, err
+	}
+	return negate(v), nil
+}
+
+// Truth value of a condition; NULL is neither true nor false.
+func truth(v btree.Value) (isTrue bool, isNull bool) {
+	if v.IsNull() {
+		return false, true
+	}
+	return v.Numeric().Float64() != 0, false
+}
+
+func boolValue(b bool) btree.Value {
+	if b {
+		return btree.IntegerValue(1)
+	}
+	return btree.IntegerValue(0)
+}
+
+func compileUnary(expr *sql.UnaryExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	operand := expr.X
+	for paren, ok := operand.(*sql.ParenExpr); ok; paren, ok = operand.(*sql.ParenExpr) {
+		operand = paren.X
+	}
+	if lit, ok := operand.(*sql.NumberLit); ok && expr.Op == sql.MINUS {
+		v, err := negativeNumberLiteral(lit.Value)
+		if err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+		return constant(v), btree.BlobAffinity, nil
+	}
+	x, _, err := compileExpr(expr.X, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	switch expr.Op {
+	case sql.PLUS:
+		// no conversion at all, but the column affinity is gone.
+		return x, btree.BlobAffinity, nil
+	case sql.MINUS:
+		return func(env *evalEnv) (btree.Value, error) {
+			v, err := x(env)
+			if err != nil || v.IsNull() {
+				return v, err
+			}
+			return negate(v.Numeric()), nil
+		}, btree.BlobAffinity, nil
+	case sql.NOT:
+		return func(env *evalEnv) (btree.Value, error) {
+			v, err := x(env)
+			if err != nil {
+				return v, err
+			}
+			isTrue, isNull := truth(v)
+			if isNull {
+				return btree.NullValue(), nil
+			}
+			return boolValue(!isTrue), nil
+		}, btree.BlobAffinity, nil
+	case sql.BITNOT:
+		return func(env *evalEnv) (btree.Value, error) {
+			v, err := x(env)
+			if err != nil || v.IsNull() {
+				return v, err
+			}
+			return btree.IntegerValue(^v.Numeric().Integer()), nil
+		}, btree.BlobAffinity, nil
+	}
+	return nil, btree.BlobAffinity, fmt.Errorf("unsupported unary operator %s", expr.Op)
+}
+
+func negate(v btree.Value) btree.Value {
+	if v.Class() == btree.IntegerClass {
+		if v.Integer() == math.MinInt64 {
+			return btree.RealValue(-float64(math.MinInt64))
+		}
+		return btree.IntegerValue(-v.Integer())
+	}
+	return btree.RealValue(-v.Float64())
+}
+
+func compileBinary(expr *sql.BinaryExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	if without, ok := hoistNot(expr); ok {
+		return compileUnary(&sql.UnaryExpr{Op: sql.NOT, X: without}, sc)
+	}
+	switch expr.Op {
+	case sql.IN, sql.NOTIN:
+		return compileIn(expr, sc)
+	case sql.BETWEEN, sql.NOTBETWEEN:
+		return compileBetween(expr, sc)
+	case sql.LIKE, sql.NOTLIKE, sql.GLOB, sql.NOTGLOB:
+		return compileLike(expr, sc)
+	}
+	x, ax, err := compileExpr(expr.X, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	y, ay, err := compileExpr(expr.Y, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	switch expr.Op {
+	case sql.AND, sql.OR:
+		isAnd := expr.Op == sql.AND
+		return func(env *evalEnv) (btree.Value, error) {
+			l, err := x(env)
+			if err != nil {
+				return l, err
+			}
+			lTrue, lNull := truth(l)
+			// short circuit: FALSE AND .. / TRUE OR ..
+			if !lNull && lTrue != isAnd {
+				return boolValue(lTrue), nil
+			}
+			r, err := y(env)
+			if err != nil {
+				return r, err
+			}
+			rTrue, rNull := truth(r)
+			if !rNull && rTrue != isAnd {
+				return boolValue(rTrue), nil
+			}
+			if lNull || rNull {
+				return btree.NullValue(), nil
+			}
+			return boolValue(isAnd), nil
+		}, btree.BlobAffinity, nil
+	case sql.EQ, sql.NE, sql.LT, sql.LE, sql.GT, sql.GE:
+		op := expr.Op
+		collation := comparisonCollation(expr.X, expr.Y, sc)
+		return func(env *evalEnv) (btree.Value, error) {
+			l, r, err := evalPair(env, x, y)
+			if err != nil || l.IsNull() || r.IsNull() {
+				return btree.NullValue(), err
+			}
+			return boolValue(compareResult(op, compareWithAffinity(l, ax, r, ay, collation))), nil
+		}, btree.BlobAffinity, nil
+	case sql.IS, sql.ISNOT:
+		isNot := expr.Op == sql.ISNOT
+		collation := comparisonCollation(expr.X, expr.Y, sc)
+		return func(env *evalEnv) (btree.Value, error) {
+			l, r, err := evalPair(env, x, y)
+			if err != nil {
+				return btree.NullValue(), err
+			}
+			equal := l.IsNull() && r.IsNull()
+			if !l.IsNull() && !r.IsNull() {
+				equal = compareWithAffinity(l, ax, r, ay, collation) == 0
+			}
+			return boolValue(equal != isNot), nil
+		}, btree.BlobAffinity, nil
+	case sql.PLUS, sql.MINUS, sql.STAR, sql.SLASH, sql.REM:
+		op := expr.Op
+		return func(env *evalEnv) (btree.Value, error) {
+			l, r, err := evalPair(env, x, y)
+			if err != nil || l.IsNull() || r.IsNull() {
+				return btree.NullValue(), err
+			}
+			return arithmetic(op, l.Numeric(), r.Numeric()), nil
+		}, btree.BlobAffinity, nil
+	case sql.BITAND, sql.BITOR, sql.LSHIFT, sql.RSHIFT:
+		op := expr.Op
+		return func(env *evalEnv) (btree.Value, error) {
+			l, r, err := evalPair(env, x, y)
+			if err != nil || l.IsNull() || r.IsNull() {
+				return btree.NullValue(), err
+			}
+			return btree.IntegerValue(bitwise(op, l.Numeric().Integer(), r.Numeric().Integer())), nil
+		}, btree.BlobAffinity, nil
+	case sql.CONCAT:
+		return func(env *evalEnv) (btree.Value, error) {
+			l, r, err := evalPair(env, x, y)
+			if err != nil || l.IsNull() || r.IsNull() {
+				return btree.NullValue(), err
+			}
+			return btree.TextValue(l.Text() + r.Text()), nil
+		}, btree.BlobAffinity, nil
+	}
+	return nil, btree.BlobAffinity, fmt.Errorf("unsupported operator %s", expr.Op)
+}
+
+// rqlite/sql binds NOT tighter than everything else, so `NOT a + 1 > 2` comes as `((NOT a) + 1) > 2`.
+// In SQLite only AND/OR bind looser than NOT; returns the expression with its leftmost NOT taken out. (i.e. `a + 1 > 2`)
+func hoistNot(expr *sql.BinaryExpr) (sql.Expr, bool) {
+	if expr.Op == sql.AND || expr.Op == sql.OR {
+		return nil, false
+	}
+	var x sql.Expr
+	switch left := expr.X.(type) {
+	case *sql.UnaryExpr:
+		if left.Op != sql.NOT {
+			return nil, false
+		}
+		x = left.X
+	case *sql.BinaryExpr:
+		without, ok := hoistNot(left)
+		if !ok {
+			return nil, false
+		}
+		x = without
+	default:
+		return nil, false
+	}
+	inner := *expr
+	inner.X = x
+	return &inner, true
+}
+
+func evalPair(env *evalEnv, x evaluator, y evaluator) (btree.Value, btree.Value, error) {
+	l, err := x(env)
+	if err != nil {
+		return l, l, err
+	}
+	r, err := y(env)
+	return l, r, err
+}
+
+// Compare two non-NULL values after the conversions SQLite applies to the operands of a comparison, TEXT by `collation`.
+//
+// * numeric affinity on one side converts the other side (unless it has a numeric affinity too).
+// * TEXT affinity on one side converts the other side when it has no affinity.
+func compareWithAffinity(l btree.Value, la btree.Affinity, r btree.Value, ra btree.Affinity, collation string) int {
+	switch {
+	case la.IsNumeric() && !ra.IsNumeric():
+		r = r.ApplyAffinity(btree.NumericAffinity)
+	case ra.IsNumeric() && !la.IsNumeric():
+		l = l.ApplyAffinity(btree.NumericAffinity)
+	case la == btree.TextAffinity && ra == btree.BlobAffinity:
+		r = r.ApplyAffinity(btree.TextAffinity)
+	case ra == btree.TextAffinity && la == btree.BlobAffinity:
+		l = l.ApplyAffinity(btree.TextAffinity)
+	}
+	return btree.CompareCollated(l, r, collation)
+}
+
+// The collation a comparison uses: the one of the left operand when it is a column, else the one of the right
+// operand when that is a column, BINARY otherwise. (e.g. `'A' = c` compares by the collation of c)
+func comparisonCollation(x sql.Expr, y sql.Expr, sc *scope) string {
+	for _, operand := range []sql.Expr{x, y} {
+		if collation, ok := exprCollation(operand, sc); ok {
+			return collation
+		}
+	}
+	return "BINARY"
+}
+
+// The declared collation of a column reference; BINARY and false for other expressions.
+func exprCollation(expr sql.Expr, sc *scope) (string, bool) {
+	si, ci, ok := columnReference(expr, sc)
+	if !ok {
+		return "BINARY", false
+	}
+	return sc.sources[si].table.columnCollation(ci), true
+}
+
+func compareResult(op sql.Token, c int) bool {
+	switch op {
+	case sql.EQ:
+		return c == 0
+	case sql.NE:
+		return c != 0
+	case sql.LT:
+		return c < 0
+	case sql.LE:
+		return c <= 0
+	case sql.GT:
+		return c > 0
+	}
+	return c >= 0
+}
+
+// Both operands are already numeric. Integers overflow into reals; division by zero is NULL.
+func arithmetic(op sql.Token, l btree.Value, r btree.Value) btree.Value {
+	if l.Class() == btree.IntegerClass && r.Class() == btree.IntegerClass {
+		a, b := l.Integer(), r.Integer()
+		switch op {
+		case sql.PLUS:
+			if s := a + b; (s > a) == (b > 0) {
+				return btree.IntegerValue(s)
+			}
+		case sql.MINUS:
+			if s := a - b; (s < a) == (b > 0) {
+				return btree.IntegerValue(s)
+			}
+		case sql.STAR:
+			if a == 0 || b == 0 {
+				return btree.IntegerValue(0)
+			}
+			if p := a * b; p/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+				return btree.IntegerValue(p)
+			}
+		case sql.SLASH:
+			if b == 0 {
+				return btree.NullValue()
+			}
+			if !(a == math.MinInt64 && b == -1) {
+				return btree.IntegerValue(a / b)
+			}
+		case sql.REM:
+			if b == 0 {
+				return btree.NullValue()
+			}
+			if b == -1 {
+				return btree.IntegerValue(0)
+			}
+			return btree.IntegerValue(a % b)
+		}
+	}
+	a, b := l.Float64(), r.Float64()
+	var f float64
+	switch op {
+	case sql.PLUS:
+		f = a + b
+	case sql.MINUS:
+		f = a - b
+	case sql.STAR:
+		f = a * b
+	case sql.SLASH:
+		if b == 0 {
+			return btree.NullValue()
+		}
+		f = a / b
+	case sql.REM:
+		// the remainder of the integer parts, as a real.
+		ia, ib := l.Integer(), r.Integer()
+		if ib == 0 {
+			return btree.NullValue()
+		}
+		if ib == -1 {
+			return btree.RealValue(0)
+		}
+		f = float64(ia % ib)
+	}
+	if math.IsNaN(f) {
+		return btree.NullValue()
+	}
+	return btree.RealValue(f)
+}
+
+func bitwise(op sql.Token, a int64, b int64) int64 {
+	switch op {
+	case sql.BITAND:
+		return a & b
+	case sql.BITOR:
+		return a | b
+	case sql.RSHIFT:
+		if b == math.MinInt64 {
+			b = -math.MaxInt64
+		}
+		b = -b
+	}
+	// shift left by b, a negative b shifts right.
+	switch {
+	case b >= 64:
+		return 0
+	case b >= 0:
+		return a << uint(b)
+	case b <= -64:
+		if a < 0 {
+			return -1
+		}
+		return 0
+	}
+	return a >> uint(-b)
+}
+
+func compileIn(expr *sql.BinaryExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	x, ax, err := compileExpr(expr.X, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	list, ok := expr.Y.(*sql.ExprList)
+	if !ok {
+		return nil, btree.BlobAffinity, fmt.Errorf("'%s' is not yet supported, IN only takes a list of values", expr.Y)
+	}
+	items := make([]evaluator, len(list.Exprs))
+	affinities := make([]btree.Affinity, len(list.Exprs))
+	for i, item := range list.Exprs {
+		if items[i], affinities[i], err = compileExpr(item, sc); err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+	}
+	isNot := expr.Op == sql.NOTIN
+	collation := comparisonCollation(expr.X, nil, sc)
+	return func(env *evalEnv) (btree.Value, error) {
+		l, err := x(env)
+		if err != nil {
+			return l, err
+		}
+		if len(items) == 0 {
+			// x IN () is always false, even for a NULL x.
+			return boolValue(isNot), nil
+		}
+		if l.IsNull() {
+			return btree.NullValue(), nil
+		}
+		sawNull := false
+		for i, item := range items {
+			r, err := item(env)
+			if err != nil {
+				return r, err
+			}
+			if r.IsNull() {
+				sawNull = true
+				continue
+			}
+			if compareWithAffinity(l, ax, r, affinities[i], collation) == 0 {
+				return boolValue(!isNot), nil
+			}
+		}
+		if sawNull {
+			return btree.NullValue(), nil
+		}
+		return boolValue(isNot), nil
+	}, btree.BlobAffinity, nil
+}
+
+func compileBetween(expr *sql.BinaryExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	rng, ok := expr.Y.(*sql.Range)
+	if !ok {
+		return nil, btree.BlobAffinity, fmt.Errorf("malformed BETWEEN expression %s", expr)
+	}
+	// x BETWEEN a AND b is the same as x >= a AND x <= b
+	op := sql.AND
+	lower, upper := sql.GE, sql.LE
+	if expr.Op == sql.NOTBETWEEN {
+		op, lower, upper = sql.OR, sql.LT, sql.GT
+	}
+	return compileBinary(&sql.BinaryExpr{
+		X:  &sql.BinaryExpr{X: expr.X, Op: lower, Y: rng.X},
+		Op: op,
+		Y:  &sql.BinaryExpr{X: expr.X, Op: upper, Y: rng.Y},
+	}, sc)
+}
+
+func compileLike(expr *sql.BinaryExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	x, _, err := compileExpr(expr.X, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	patternExpr := expr.Y
+	var escape evaluator
+	if esc, ok := patternExpr.(*sql.BinaryExpr); ok && esc.Op == sql.ESCAPE {
+		patternExpr = esc.X
+		if escape, _, err = compileExpr(esc.Y, sc); err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+	}
+	pattern, _, err := compileExpr(patternExpr, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	isGlob := expr.Op == sql.GLOB || expr.Op == sql.NOTGLOB
+	isNot := expr.Op == sql.NOTLIKE || expr.Op == sql.NOTGLOB
+	return func(env *evalEnv) (btree.Value, error) {
+		l, p, err := evalPair(env, x, pattern)
+		if err != nil || l.IsNull() || p.IsNull() {
+			return btree.NullValue(), err
+		}
+		if isGlob {
+			return boolValue(globMatch(p.Text(), l.Text()) != isNot), nil
+		}
+		escapeChar := rune(-1)
+		if escape != nil {
+			e, err := escape(env)
+			if err != nil || e.IsNull() {
+				return btree.NullValue(), err
+			}
+			runes := []rune(e.Text())
+			if len(runes) != 1 {
+				return btree.NullValue(), fmt.Errorf("ESCAPE expression must be a single character")
+			}
+			escapeChar = runes[0]
+		}
+		return boolValue(likeMatch(p.Text(), l.Text(), escapeChar) != isNot), nil
+	}, btree.BlobAffinity, nil
+}
+
+func compileCast(expr *sql.CastExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	x, _, err := compileExpr(expr.X, sc)
+	if err != nil {
+		return nil, btree.BlobAffinity, err
+	}
+	target := btree.AffinityOf(expr.Type.Name.Name)
+	return func(env *evalEnv) (btree.Value, error) {
+		v, err := x(env)
+		if err != nil || v.IsNull() {
+			return v, err
+		}
+		return castValue(v, target), nil
+	}, target, nil
+}
+
+// CAST(v AS <type of given affinity>)
+func castValue(v btree.Value, target btree.Affinity) btree.Value {
+	switch target {
+	case btree.TextAffinity:
+		return btree.TextValue(v.Text())
+	case btree.IntegerAffinity:
+		return btree.IntegerValue(v.Integer())
+	case btree.RealAffinity:
+		return btree.RealValue(v.Float64())
+	case btree.NumericAffinity:
+		return v.Numeric().ApplyAffinity(btree.NumericAffinity)
+	}
+	return btree.BlobValue(v.Bytes())
+}
+
+func compileCase(expr *sql.CaseExpr, sc *scope) (evaluator, btree.Affinity, error) {
+	var operand evaluator
+	var operandAffinity btree.Affinity
+	var err error
+	if expr.Operand != nil {
+		if operand, operandAffinity, err = compileExpr(expr.Operand, sc); err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+	}
+	type caseBlock struct {
+		condition         evaluator
+		conditionAffinity btree.Affinity
+		collation         string
+		body              evaluator
+	}
+	blocks := make([]caseBlock, len(expr.Blocks))
+	for i, blk := range expr.Blocks {
+		if blocks[i].condition, blocks[i].conditionAffinity, err = compileExpr(blk.Condition, sc); err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+		if expr.Operand != nil {
+			blocks[i].collation = comparisonCollation(expr.Operand, blk.Condition, sc)
+		}
+		if blocks[i].body, _, err = compileExpr(blk.Body, sc); err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+	}
+	elseExpr := constant(btree.NullValue())
+	if expr.ElseExpr != nil {
+		if elseExpr, _, err = compileExpr(expr.ElseExpr, sc); err != nil {
+			return nil, btree.BlobAffinity, err
+		}
+	}
+	return func(env *evalEnv) (btree.Value, error) {
+		var base btree.Value
+		if operand != nil {
+			v, err := operand(env)
+			if err != nil {
+				return v, err
+			}
+			base = v
+		}
+		for _, blk := range blocks {
+			c, err := blk.condition(env)
+			if err != nil {
+				return c, err
+			}
+			matched := false
+			if operand == nil {
+				matched, _ = truth(c)
+			} else if !base.IsNull() && !c.IsNull() {
+				matched = compareWithAffinity(base, operandAffinity, c, blk.conditionAffinity, blk.collation) == 0
+			}
+			if matched {
+				return blk.body(env)
+			}
+		}
+		return elseExpr(env)
+	}, btree.BlobAffinity, nil
+}
@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// A negated number literal is what sqlite3 gives `quote(-<literal>)`.
+func TestNegativeNumberLiteral(t *testing.T) {
+	cases := []struct {
+		literal string
+		want    string
+	}{
+		{"5", "-5"},
+		{"0", "0"},
+		{"1.5", "-1.5"},
+		{"9223372036854775807", "-9223372036854775807"},
+		{"9223372036854775808", "-9223372036854775808"},
+		{"0009223372036854775808", "-9223372036854775808"},
+		{"9223372036854775809", "-9.22337203685477581e+18"},
+		{"9223372036854775808.0", "-9.22337203685477581e+18"},
+	}
+	for _, c := range cases {
+		v, err := negativeNumberLiteral(c.literal)
+		if err != nil {
+			t.Errorf("-%s failed: %v", c.literal, err)
+			continue
+		}
+		if got := quoteValue(v); got != c.want {
+			t.Errorf("-%s = %s, want %s", c.literal, got, c.want)
+		}
+	}
+	if v, _ := negativeNumberLiteral("9223372036854775808"); v.Class() != btree.IntegerClass {
+		t.Errorf("-9223372036854775808 is %v, want an integer", v.Class())
+	}
+}
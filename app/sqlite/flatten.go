@@ -0,0 +1,244 @@
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// Like sqlite3's query flattener, a SELECT that reads a single view is run as the view's SELECT with the terms of
+// the outer one put in. Over `CREATE VIEW v AS SELECT id, name FROM t WHERE grp = 1`,
+//
+//	SELECT name FROM v WHERE id > 5  runs as  SELECT name FROM t WHERE grp = 1 AND id > 5
+//
+// which reads t through its rowid or indexes instead of a co-routine. Only views of one table without DISTINCT or
+// aggregates are flattened; with LIMIT or ORDER BY only where sqlite3 does. False when the SELECT stays as it is.
+func (d *Db) flattenView(stmt *sql.SelectStatement, columnTexts []string) (*sql.SelectStatement, []string, bool) {
+	source, ok := stmt.Source.(*sql.QualifiedTableName)
+	if !ok || source.Index != nil || stmt.Compound != nil {
+		return nil, nil, false
+	}
+	if _, isTable := d.Table(source.Name.Name); isTable {
+		return nil, nil, false
+	}
+	view, ok := d.View(source.Name.Name)
+	if !ok {
+		return nil, nil, false
+	}
+	inner := view.viewSpec.Select
+	if _, ok := inner.Source.(*sql.QualifiedTableName); !ok || inner.Compound != nil || inner.Distinct.IsValid() ||
+		isAggregateQuery(inner) || len(inner.Windows) > 0 {
+		return nil, nil, false
+	}
+	outerAggregate := isAggregateQuery(stmt)
+	if inner.LimitExpr != nil && (inner.OffsetExpr != nil || stmt.LimitExpr != nil || stmt.WhereExpr != nil ||
+		outerAggregate || stmt.Distinct.IsValid()) {
+		// the outer query works on the rows the LIMIT leaves.
+		return nil, nil, false
+	}
+	if len(inner.OrderingTerms) > 0 && outerAggregate {
+		return nil, nil, false
+	}
+
+	// what each column of the view stands for; `*` is the columns of the view's table.
+	tbl, err := d.viewTable(view)
+	if err != nil {
+		return nil, nil, false
+	}
+	innerSources, _, err := d.fromSources(inner.Source)
+	if err != nil {
+		return nil, nil, false
+	}
+	var exprs []sql.Expr
+	for _, column := range inner.Columns {
+		ref, isRef := column.Expr.(*sql.QualifiedRef)
+		if column.Star.IsValid() || (isRef && ref.Star.IsValid() && strings.EqualFold(ref.Table.Name, innerSources[0].name)) {
+			for _, col := range innerSources[0].table.tableSpec.Columns {
+				exprs = append(exprs, &sql.QualifiedRef{Table: &sql.Ident{Name: innerSources[0].name}, Column: &sql.Ident{Name: col.Name}})
+			}
+			continue
+		}
+		exprs = append(exprs, column.Expr)
+	}
+	if len(exprs) != len(tbl.tableSpec.Columns) {
+		return nil, nil, false
+	}
+	f := &flattener{source: source.Name.Name, columns: map[string]sql.Expr{}, aliases: resultAliases(stmt.Columns)}
+	if source.Alias != nil {
+		f.source = source.Alias.Name
+	}
+	for ci, col := range tbl.tableSpec.Columns {
+		f.columns[strings.ToLower(col.Name)] = exprs[ci]
+	}
+
+	flat := *stmt
+	flat.Source = sql.CloneSource(inner.Source)
+	flat.Columns = nil
+	var texts []string
+	for c, column := range stmt.Columns {
+		ref, isRef := column.Expr.(*sql.QualifiedRef)
+		if column.Star.IsValid() || (isRef && ref.Star.IsValid() && strings.EqualFold(ref.Table.Name, f.source)) {
+			for ci, col := range tbl.tableSpec.Columns {
+				flat.Columns = append(flat.Columns, &sql.ResultColumn{Expr: sql.CloneExpr(exprs[ci]), Alias: &sql.Ident{Name: col.Name}})
+				texts = append(texts, col.Name)
+			}
+			continue
+		}
+		result := &sql.ResultColumn{Expr: f.replace(column.Expr, false), Alias: column.Alias}
+		if name, ok := f.columnName(column.Expr); ok && result.Alias == nil {
+			// named after the view's column, as it was.
+			result.Alias = &sql.Ident{Name: name}
+		}
+		flat.Columns = append(flat.Columns, result)
+		text := ""
+		if c < len(columnTexts) {
+			text = columnTexts[c]
+		}
+		texts = append(texts, text)
+	}
+	flat.WhereExpr = conjunction(nonNil(sql.CloneExpr(inner.WhereExpr), f.replace(stmt.WhereExpr, false)))
+	flat.GroupByExprs = nil
+	for _, expr := range stmt.GroupByExprs {
+		flat.GroupByExprs = append(flat.GroupByExprs, f.replace(expr, true))
+	}
+	flat.HavingExpr = f.replace(stmt.HavingExpr, false)
+	flat.OrderingTerms = nil
+	for _, term := range stmt.OrderingTerms {
+		flatTerm := *term
+		flatTerm.X = f.replace(term.X, true)
+		flat.OrderingTerms = append(flat.OrderingTerms, &flatTerm)
+	}
+	if len(stmt.OrderingTerms) == 0 {
+		// the rows come in the view's order.
+		for _, term := range inner.OrderingTerms {
+			flat.OrderingTerms = append(flat.OrderingTerms, &sql.OrderingTerm{
+				X: sql.CloneExpr(term.X), Asc: term.Asc, Desc: term.Desc, Nulls: term.Nulls, NullsFirst: term.NullsFirst, NullsLast: term.NullsLast,
+			})
+		}
+	}
+	if stmt.LimitExpr == nil {
+		flat.LimitExpr, flat.OffsetExpr = sql.CloneExpr(inner.LimitExpr), nil
+	}
+	if f.failed {
+		return nil, nil, false
+	}
+	debugf("View %s flattened into the query\n", view.Name())
+	return &flat, texts, true
+}
+
+// The SELECT with the views it reads flattened, a view of a view once for each. (see flattenView)
+func (d *Db) flattenViews(stmt *sql.SelectStatement, columnTexts []string) (*sql.SelectStatement, []string) {
+	for {
+		flat, texts, ok := d.flattenView(stmt, columnTexts)
+		if !ok {
+			return stmt, columnTexts
+		}
+		stmt, columnTexts = flat, texts
+	}
+}
+
+// The expressions that are not nil.
+func nonNil(exprs ...sql.Expr) []sql.Expr {
+	var out []sql.Expr
+	for _, expr := range exprs {
+		if expr != nil {
+			out = append(out, expr)
+		}
+	}
+	return out
+}
+
+// Puts the expressions of a view's columns in place of the references to them.
+type flattener struct {
+	source  string              // name of the view in the outer query, or its alias.
+	columns map[string]sql.Expr // lower-cased column name of the view -> what it stands for.
+	aliases map[string]sql.Expr // result aliases of the outer query.
+	failed  bool                // something could not be put in; the query is not flattened.
+}
+
+// The view column the expression refers to.
+func (f *flattener) columnName(expr sql.Expr) (string, bool) {
+	var name string
+	switch expr := expr.(type) {
+	case *sql.Ident:
+		name = expr.Name
+	case *sql.QualifiedRef:
+		if expr.Star.IsValid() || !strings.EqualFold(expr.Table.Name, f.source) {
+			return "", false
+		}
+		name = expr.Column.Name
+	default:
+		return "", false
+	}
+	if _, ok := f.columns[strings.ToLower(name)]; !ok {
+		return "", false
+	}
+	return name, true
+}
+
+// A copy of the expression with the view's columns put in. With `aliasesFirst` (ORDER BY and GROUP BY) a name is a
+// result alias before it is a column, otherwise it is a column first.
+func (f *flattener) replace(expr sql.Expr, aliasesFirst bool) sql.Expr {
+	switch expr := expr.(type) {
+	case nil:
+		return nil
+	case *sql.Ident:
+		if _, ok := f.aliases[strings.ToLower(expr.Name)]; ok && aliasesFirst {
+			return expr.Clone()
+		}
+		if column, ok := f.columns[strings.ToLower(expr.Name)]; ok {
+			return sql.CloneExpr(column)
+		}
+		if _, ok := f.aliases[strings.ToLower(expr.Name)]; !ok {
+			// not a column of the view. (e.g. rowid)
+			f.failed = true
+		}
+		return expr.Clone()
+	case *sql.QualifiedRef:
+		if name, ok := f.columnName(expr); ok {
+			return sql.CloneExpr(f.columns[strings.ToLower(name)])
+		}
+		f.failed = true
+		return expr.Clone()
+	case *sql.BinaryExpr:
+		return &sql.BinaryExpr{X: f.replace(expr.X, aliasesFirst), OpPos: expr.OpPos, Op: expr.Op, Y: f.replace(expr.Y, aliasesFirst)}
+	case *sql.UnaryExpr:
+		return &sql.UnaryExpr{OpPos: expr.OpPos, Op: expr.Op, X: f.replace(expr.X, aliasesFirst)}
+	case *sql.ParenExpr:
+		return &sql.ParenExpr{Lparen: expr.Lparen, X: f.replace(expr.X, aliasesFirst), Rparen: expr.Rparen}
+	case *sql.CastExpr:
+		cast := expr.Clone()
+		cast.X = f.replace(expr.X, aliasesFirst)
+		return cast
+	case *sql.Range:
+		return &sql.Range{X: f.replace(expr.X, aliasesFirst), And: expr.And, Y: f.replace(expr.Y, aliasesFirst)}
+	case *sql.ExprList:
+		list := &sql.ExprList{Lparen: expr.Lparen, Rparen: expr.Rparen}
+		for _, x := range expr.Exprs {
+			list.Exprs = append(list.Exprs, f.replace(x, aliasesFirst))
+		}
+		return list
+	case *sql.CaseExpr:
+		c := &sql.CaseExpr{Case: expr.Case, Operand: f.replace(expr.Operand, aliasesFirst), Else: expr.Else, ElseExpr: f.replace(expr.ElseExpr, aliasesFirst), End: expr.End}
+		for _, block := range expr.Blocks {
+			c.Blocks = append(c.Blocks, &sql.CaseBlock{When: block.When, Condition: f.replace(block.Condition, aliasesFirst), Then: block.Then, Body: f.replace(block.Body, aliasesFirst)})
+		}
+		return c
+	case *sql.Call:
+		if expr.Filter != nil || expr.Over != nil {
+			f.failed = true
+			return expr.Clone()
+		}
+		call := expr.Clone()
+		for a, arg := range expr.Args {
+			call.Args[a] = f.replace(arg, aliasesFirst)
+		}
+		return call
+	case *sql.Exists, *sql.Raise:
+		f.failed = true
+		return sql.CloneExpr(expr)
+	default:
+		// literals and bound parameters.
+		return sql.CloneExpr(expr)
+	}
+}
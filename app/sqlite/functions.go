@@ -0,0 +1,446 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// A built-in scalar function, called with its arguments already evaluated.
+type scalarFunction struct {
+	minArgs int
+	maxArgs int // -1 for any number
+	call    func(args []btree.Value) (btree.Value, error)
+}
+
+// Largest blob/text a function may produce. (SQLITE_MAX_LENGTH)
+const MAX_VALUE_LENGTH = 1000000000
+
+// The core scalar functions by (lowercase) name.
+//
+// See https://www.sqlite.org/lang_corefunc.html
+var scalarFunctions = map[string]scalarFunction{
+	"abs":        {1, 1, fnAbs},
+	"char":       {0, -1, fnChar},
+	"coalesce":   {2, -1, fnCoalesce},
+	"format":     {0, -1, fnPrintf},
+	"hex":        {1, 1, fnHex},
+	"ifnull":     {2, 2, fnCoalesce},
+	"iif":        {2, 3, fnIif},
+	"instr":      {2, 2, fnInstr},
+	"length":     {1, 1, fnLength},
+	"likelihood": {2, 2, fnLikelihood},
+	"likely":     {1, 1, fnIdentity},
+	"lower":      {1, 1, textFunction(lowerText)},
+	"ltrim":      {1, 2, trimFunction(true, false)},
+	"max":        {1, -1, extremeFunction(1)}, // with a single argument max() is the aggregate.
+	"min":        {1, -1, extremeFunction(-1)},
+	"nullif":     {2, 2, fnNullif},
+	"printf":     {0, -1, fnPrintf},
+	"quote":      {1, 1, fnQuote},
+	"random":     {0, 0, fnRandom},
+	"randomblob": {1, 1, fnRandomblob},
+	"replace":    {3, 3, fnReplace},
+	"round":      {1, 2, fnRound},
+	"rtrim":      {1, 2, trimFunction(false, true)},
+	"substr":     {2, 3, fnSubstr},
+	"substring":  {2, 3, fnSubstr},
+	"trim":       {1, 2, trimFunction(true, true)},
+	"typeof":     {1, 1, fnTypeof},
+	"unhex":      {1, 2, fnUnhex},
+	"unicode":    {1, 1, fnUnicode},
+	"unlikely":   {1, 1, fnIdentity},
+	"upper":      {1, 1, textFunction(upperText)},
+	"zeroblob":   {1, 1, fnZeroblob},
+}
+
+// Like SQLite without ICU, only ASCII letters change case.
+func upperText(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+func lowerText(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c - 'A' + 'a'
+		}
+	}
+	return string(b)
+}
+
+// A function of the text of its argument; NULL stays NULL.
+func textFunction(fn func(string) string) func(args []btree.Value) (btree.Value, error) {
+	return func(args []btree.Value) (btree.Value, error) {
+		if args[0].IsNull() {
+			return args[0], nil
+		}
+		return btree.TextValue(fn(args[0].Text())), nil
+	}
+}
+
+func fnIdentity(args []btree.Value) (btree.Value, error) {
+	return args[0], nil
+}
+
+func fnLikelihood(args []btree.Value) (btree.Value, error) {
+	if p := args[1]; p.Class() != btree.RealClass || p.Float64() < 0 || p.Float64() > 1 {
+		return btree.Value{}, fmt.Errorf("second argument to likelihood() must be a constant between 0.0 and 1.0")
+	}
+	return args[0], nil
+}
+
+func fnAbs(args []btree.Value) (btree.Value, error) {
+	switch v := args[0]; v.Class() {
+	case btree.NullClass:
+		return v, nil
+	case btree.IntegerClass:
+		if v.Integer() == math.MinInt64 {
+			return btree.Value{}, fmt.Errorf("integer overflow")
+		}
+		if v.Integer() < 0 {
+			return btree.IntegerValue(-v.Integer()), nil
+		}
+		return v, nil
+	default:
+		// text and blobs become reals, 0.0 when they are not numbers.
+		return btree.RealValue(math.Abs(v.Float64())), nil
+	}
+}
+
+func fnChar(args []btree.Value) (btree.Value, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		c := arg.Integer()
+		if c < 0 || c > utf8.MaxRune {
+			c = utf8.RuneError
+		}
+		b.WriteRune(rune(c))
+	}
+	return btree.TextValue(b.String()), nil
+}
+
+// coalesce() and ifnull(); the first argument that is not NULL.
+func fnCoalesce(args []btree.Value) (btree.Value, error) {
+	for _, arg := range args {
+		if !arg.IsNull() {
+			return arg, nil
+		}
+	}
+	return btree.NullValue(), nil
+}
+
+func fnHex(args []btree.Value) (btree.Value, error) {
+	return btree.TextValue(strings.ToUpper(hex.EncodeToString(args[0].Bytes()))), nil
+}
+
+func fnIif(args []btree.Value) (btree.Value, error) {
+	if isTrue, _ := truth(args[0]); isTrue {
+		return args[1], nil
+	}
+	if len(args) > 2 {
+		return args[2], nil
+	}
+	return btree.NullValue(), nil
+}
+
+// instr(X, Y); 1-based position of Y within X, in bytes for two blobs, otherwise in characters.
+func fnInstr(args []btree.Value) (btree.Value, error) {
+	x, y := args[0], args[1]
+	if x.IsNull() || y.IsNull() {
+		return btree.NullValue(), nil
+	}
+	if x.Class() == btree.BlobClass && y.Class() == btree.BlobClass {
+		return btree.IntegerValue(int64(bytes.Index(x.Bytes(), y.Bytes()) + 1)), nil
+	}
+	s := x.Text()
+	at := strings.Index(s, y.Text())
+	if at < 0 {
+		return btree.IntegerValue(0), nil
+	}
+	return btree.IntegerValue(int64(utf8.RuneCountInString(s[:at]) + 1)), nil
+}
+
+// length(X); characters before the first NUL, bytes for a blob.
+func fnLength(args []btree.Value) (btree.Value, error) {
+	switch v := args[0]; v.Class() {
+	case btree.NullClass:
+		return v, nil
+	case btree.BlobClass:
+		return btree.IntegerValue(int64(len(v.Bytes()))), nil
+	default:
+		s := v.Text()
+		if nul := strings.IndexByte(s, 0); nul >= 0 {
+			s = s[:nul]
+		}
+		return btree.IntegerValue(int64(utf8.RuneCountInString(s))), nil
+	}
+}
+
+// Scalar min() (sign -1) and max() (sign 1); NULL when any argument is NULL.
+func extremeFunction(sign int) func(args []btree.Value) (btree.Value, error) {
+	return func(args []btree.Value) (btree.Value, error) {
+		best := args[0]
+		for _, arg := range args {
+			if arg.IsNull() {
+				return arg, nil
+			}
+			if btree.Compare(arg, best)*sign > 0 {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+}
+
+func fnNullif(args []btree.Value) (btree.Value, error) {
+	if btree.Compare(args[0], args[1]) == 0 {
+		return btree.NullValue(), nil
+	}
+	return args[0], nil
+}
+
+func fnPrintf(args []btree.Value) (btree.Value, error) {
+	if len(args) == 0 || args[0].IsNull() {
+		return btree.NullValue(), nil
+	}
+	return btree.TextValue(sqlitePrintf(args[0].Text(), args[1:])), nil
+}
+
+// quote(X); X as an SQL literal.
+func fnQuote(args []btree.Value) (btree.Value, error) {
+	return btree.TextValue(quoteValue(args[0])), nil
+}
+
+func quoteValue(v btree.Value) string {
+	switch v.Class() {
+	case btree.NullClass:
+		return "NULL"
+	case btree.IntegerClass:
+		return v.Text()
+	case btree.RealClass:
+		// 15 digits when they are enough to read back the same value, otherwise 20.
+		s := btree.FormatReal(v.Float64())
+		if back, err := strconv.ParseFloat(s, 64); err != nil || back != v.Float64() {
+			s = sqlitePrintf("%!.20e", []btree.Value{v})
+		}
+		return s
+	case btree.BlobClass:
+		return "X'" + strings.ToUpper(hex.EncodeToString(v.Bytes())) + "'"
+	}
+	return "'" + strings.ReplaceAll(v.Text(), "'", "''") + "'"
+}
+
+func fnRandom(args []btree.Value) (btree.Value, error) {
+	return btree.IntegerValue(int64(rand.Uint64())), nil
+}
+
+func fnRandomblob(args []btree.Value) (btree.Value, error) {
+	n := args[0].Integer()
+	if n < 1 {
+		n = 1
+	}
+	if n > MAX_VALUE_LENGTH {
+		return btree.Value{}, fmt.Errorf("string or blob too big")
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+	return btree.BlobValue(b), nil
+}
+
+func fnReplace(args []btree.Value) (btree.Value, error) {
+	for _, arg := range args {
+		if arg.IsNull() {
+			return arg, nil
+		}
+	}
+	pattern := args[1].Text()
+	if pattern == "" {
+		return args[0], nil
+	}
+	return btree.TextValue(strings.ReplaceAll(args[0].Text(), pattern, args[2].Text())), nil
+}
+
+// round(X [, N]); always a real, halves are rounded away from zero.
+func fnRound(args []btree.Value) (btree.Value, error) {
+	x := args[0]
+	digits := int64(0)
+	if len(args) > 1 {
+		if args[1].IsNull() {
+			return args[1], nil
+		}
+		digits = min(max(args[1].Integer(), 0), 30)
+	}
+	if x.IsNull() {
+		return x, nil
+	}
+	r := x.Numeric().Float64()
+	switch {
+	case r < -4503599627370496 || r > 4503599627370496:
+		// no fraction left at this size.
+	case digits == 0 && r < 0:
+		r = -float64(int64(-r + 0.5))
+	case digits == 0:
+		r = float64(int64(r + 0.5))
+	default:
+		formatted := formatFloat(r, printfSpec{precision: int(digits), verb: 'f', alt2: true})
+		r, _ = strconv.ParseFloat(formatted, 64)
+	}
+	return btree.RealValue(r), nil
+}
+
+// substr(X, Y [, Z]); Z characters (bytes for a blob) starting at Y, 1-based. Negative Y counts from the end,
+// negative Z takes the characters before Y.
+func fnSubstr(args []btree.Value) (btree.Value, error) {
+	for _, arg := range args {
+		if arg.IsNull() {
+			return arg, nil
+		}
+	}
+	x := args[0]
+	isBlob := x.Class() == btree.BlobClass
+	var runes []rune
+	var data []byte
+	length := int64(0)
+	if isBlob {
+		data = x.Bytes()
+		length = int64(len(data))
+	} else {
+		runes = []rune(x.Text())
+		length = int64(len(runes))
+	}
+	p1 := args[1].Integer()
+	p2 := int64(MAX_VALUE_LENGTH)
+	negP2 := false
+	if len(args) > 2 {
+		p2 = args[2].Integer()
+		if p2 < 0 {
+			p2, negP2 = -p2, true
+		}
+	}
+	// same arithmetic as SQLite's substrFunc().
+	if p1 < 0 {
+		p1 += length
+		if p1 < 0 {
+			p2 += p1
+			if p2 < 0 {
+				p2 = 0
+			}
+			p1 = 0
+		}
+	} else if p1 > 0 {
+		p1--
+	} else if p2 > 0 {
+		p2--
+	}
+	if negP2 {
+		p1 -= p2
+		if p1 < 0 {
+			p2 += p1
+			p1 = 0
+		}
+	}
+	start := min(p1, length)
+	// p2 may be up to the largest integer, start+p2 would overflow.
+	end := start + min(p2, length-start)
+	if isBlob {
+		return btree.BlobValue(data[start:end]), nil
+	}
+	return btree.TextValue(string(runes[start:end])), nil
+}
+
+// trim(), ltrim() and rtrim(); remove the characters of Y (spaces by default) from the ends of X.
+func trimFunction(left bool, right bool) func(args []btree.Value) (btree.Value, error) {
+	return func(args []btree.Value) (btree.Value, error) {
+		cutset := " "
+		if len(args) > 1 {
+			if args[1].IsNull() {
+				return args[1], nil
+			}
+			cutset = args[1].Text()
+		}
+		if args[0].IsNull() {
+			return args[0], nil
+		}
+		s := args[0].Text()
+		if left {
+			s = strings.TrimLeft(s, cutset)
+		}
+		if right {
+			s = strings.TrimRight(s, cutset)
+		}
+		return btree.TextValue(s), nil
+	}
+}
+
+func fnTypeof(args []btree.Value) (btree.Value, error) {
+	return btree.TextValue(args[0].Class().String()), nil
+}
+
+// unhex(X [, Y]); the blob written in hex by X, characters of Y may appear between the bytes. NULL when X is not hex.
+func fnUnhex(args []btree.Value) (btree.Value, error) {
+	ignore := ""
+	if len(args) > 1 {
+		if args[1].IsNull() {
+			return args[1], nil
+		}
+		ignore = args[1].Text()
+	}
+	if args[0].IsNull() {
+		return args[0], nil
+	}
+	s := args[0].Text()
+	out := make([]byte, 0, len(s)/2)
+	for i := 0; i < len(s); {
+		ch, size := utf8.DecodeRuneInString(s[i:])
+		if strings.ContainsRune(ignore, ch) {
+			i += size
+			continue
+		}
+		if i+1 >= len(s) {
+			return btree.NullValue(), nil
+		}
+		b, err := hex.DecodeString(s[i : i+2])
+		if err != nil {
+			return btree.NullValue(), nil
+		}
+		out = append(out, b[0])
+		i += 2
+	}
+	return btree.BlobValue(out), nil
+}
+
+func fnUnicode(args []btree.Value) (btree.Value, error) {
+	if args[0].IsNull() {
+		return args[0], nil
+	}
+	s := args[0].Text()
+	if s == "" {
+		return btree.NullValue(), nil
+	}
+	ch, _ := utf8.DecodeRuneInString(s)
+	return btree.IntegerValue(int64(ch)), nil
+}
+
+func fnZeroblob(args []btree.Value) (btree.Value, error) {
+	n := max(args[0].Integer(), 0)
+	if n > MAX_VALUE_LENGTH {
+		return btree.Value{}, fmt.Errorf("string or blob too big")
+	}
+	return btree.BlobValue(make([]byte, n)), nil
+}
@@ -0,0 +1,443 @@
+package sqlite
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// An SQL literal as a value: NULL, a number, 'text' or x'blob'.
+func literalValue(t *testing.T, literal string) btree.Value {
+	switch {
+	case literal == "NULL":
+		return btree.NullValue()
+	case strings.HasPrefix(literal, "'"):
+		return btree.TextValue(strings.ReplaceAll(literal[1:len(literal)-1], "''", "'"))
+	case strings.HasPrefix(literal, "x'"):
+		b, err := hex.DecodeString(literal[2 : len(literal)-1])
+		if err != nil {
+			t.Fatalf("bad blob literal %s: %v", literal, err)
+		}
+		return btree.BlobValue(b)
+	}
+	if i, err := strconv.ParseInt(literal, 10, 64); err == nil {
+		return btree.IntegerValue(i)
+	}
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil && !strings.Contains(err.Error(), "range") {
+		t.Fatalf("bad literal %s: %v", literal, err)
+	}
+	return btree.RealValue(f)
+}
+
+// Each function with NULL, INTEGER, REAL, TEXT and BLOB arguments; the results are sqlite3's `quote(f(...))`.
+func TestScalarFunctions(t *testing.T) {
+	type testCase struct {
+		args []string // SQL literals
+		want string   // quoted result
+	}
+	cases := map[string][]testCase{
+		"abs": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "7"},
+			{[]string{"-2.5"}, "2.5"},
+			{[]string{"'Hello'"}, "0.0"},
+			{[]string{"x'4142'"}, "0.0"},
+			{[]string{"'-3abc'"}, "3.0"},
+			{[]string{"-9223372036854775807"}, "9223372036854775807"},
+			{[]string{"'  -4.5'"}, "4.5"},
+			{[]string{"-0.0"}, "0.0"},
+		},
+		"hex": {
+			{[]string{"NULL"}, "''"},
+			{[]string{"7"}, "'37'"},
+			{[]string{"-2.5"}, "'2D322E35'"},
+			{[]string{"'Hello'"}, "'48656C6C6F'"},
+			{[]string{"x'4142'"}, "'4142'"},
+			{[]string{"'é'"}, "'C3A9'"},
+			{[]string{"1.5"}, "'312E35'"},
+		},
+		"length": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "1"},
+			{[]string{"-2.5"}, "4"},
+			{[]string{"'Hello'"}, "5"},
+			{[]string{"x'4142'"}, "2"},
+			{[]string{"'héllo'"}, "5"},
+			{[]string{"x''"}, "0"},
+			{[]string{"123.0"}, "5"},
+		},
+		"lower": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "'7'"},
+			{[]string{"-2.5"}, "'-2.5'"},
+			{[]string{"'Hello'"}, "'hello'"},
+			{[]string{"x'4142'"}, "'ab'"},
+			{[]string{"'ÀBC'"}, "'Àbc'"},
+		},
+		"upper": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "'7'"},
+			{[]string{"-2.5"}, "'-2.5'"},
+			{[]string{"'Hello'"}, "'HELLO'"},
+			{[]string{"x'4142'"}, "'AB'"},
+			{[]string{"'straße'"}, "'STRAßE'"},
+		},
+		"quote": {
+			{[]string{"NULL"}, "'NULL'"},
+			{[]string{"7"}, "'7'"},
+			{[]string{"-2.5"}, "'-2.5'"},
+			{[]string{"'Hello'"}, "'''Hello'''"},
+			{[]string{"x'4142'"}, "'X''4142'''"},
+			{[]string{"'it''s'"}, "'''it''''s'''"},
+			{[]string{"1e100"}, "'1.0e+100'"},
+			{[]string{"0.1"}, "'0.1'"},
+		},
+		"typeof": {
+			{[]string{"NULL"}, "'null'"},
+			{[]string{"7"}, "'integer'"},
+			{[]string{"-2.5"}, "'real'"},
+			{[]string{"'Hello'"}, "'text'"},
+			{[]string{"x'4142'"}, "'blob'"},
+			{[]string{"1e400"}, "'real'"},
+			{[]string{"''"}, "'text'"},
+		},
+		"unicode": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "55"},
+			{[]string{"-2.5"}, "45"},
+			{[]string{"'Hello'"}, "72"},
+			{[]string{"x'4142'"}, "65"},
+			{[]string{"'é'"}, "233"},
+			{[]string{"''"}, "NULL"},
+		},
+		"likely": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "7"},
+			{[]string{"-2.5"}, "-2.5"},
+			{[]string{"'Hello'"}, "'Hello'"},
+			{[]string{"x'4142'"}, "X'4142'"},
+		},
+		"unlikely": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "7"},
+			{[]string{"-2.5"}, "-2.5"},
+			{[]string{"'Hello'"}, "'Hello'"},
+			{[]string{"x'4142'"}, "X'4142'"},
+		},
+		"trim": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "'7'"},
+			{[]string{"-2.5"}, "'-2.5'"},
+			{[]string{"'Hello'"}, "'Hello'"},
+			{[]string{"x'4142'"}, "'AB'"},
+			{[]string{"'xxHixx'", "'x'"}, "'Hi'"},
+			{[]string{"'  a  '", "NULL"}, "NULL"},
+			{[]string{"7", "7"}, "''"},
+			{[]string{"'Hello'", "'Ho'"}, "'ell'"},
+			{[]string{"x'204120'"}, "'A'"},
+		},
+		"ltrim": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "'7'"},
+			{[]string{"-2.5"}, "'-2.5'"},
+			{[]string{"'Hello'"}, "'Hello'"},
+			{[]string{"x'4142'"}, "'AB'"},
+			{[]string{"'xxHixx'", "'x'"}, "'Hixx'"},
+			{[]string{"-2.5", "'-'"}, "'2.5'"},
+		},
+		"rtrim": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "'7'"},
+			{[]string{"-2.5"}, "'-2.5'"},
+			{[]string{"'Hello'"}, "'Hello'"},
+			{[]string{"x'4142'"}, "'AB'"},
+			{[]string{"'xxHixx'", "'x'"}, "'xxHi'"},
+			{[]string{"7.50", "'0'"}, "'7.5'"},
+		},
+		"char": {
+			{[]string{"NULL"}, "'\x00'"},
+			{[]string{"7"}, "'\a'"},
+			{[]string{"-2.5"}, "'\uFFFD'"},
+			{[]string{"'Hello'"}, "'\x00'"},
+			{[]string{"x'4142'"}, "'\x00'"},
+			{[]string{"72", "105"}, "'Hi'"},
+			{[]string{}, "''"},
+			{[]string{"72", "NULL", "'105'"}, "'H\x00i'"},
+			{[]string{"72.9", "x'41'"}, "'H\x00'"},
+		},
+		"zeroblob": {
+			{[]string{"NULL"}, "X''"},
+			{[]string{"7"}, "X'00000000000000'"},
+			{[]string{"-2.5"}, "X''"},
+			{[]string{"'Hello'"}, "X''"},
+			{[]string{"x'4142'"}, "X''"},
+			{[]string{"-1"}, "X''"},
+			{[]string{"'3'"}, "X'000000'"},
+			{[]string{"2.9"}, "X'0000'"},
+		},
+		"round": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "7.0"},
+			{[]string{"-2.5"}, "-3.0"},
+			{[]string{"'Hello'"}, "0.0"},
+			{[]string{"x'4142'"}, "0.0"},
+			{[]string{"2.5"}, "3.0"},
+			{[]string{"-2.5"}, "-3.0"},
+			{[]string{"'3.14159'", "2"}, "3.14"},
+			{[]string{"2.567", "NULL"}, "NULL"},
+			{[]string{"2.567", "'1'"}, "2.6"},
+			{[]string{"1234.5678", "-2"}, "1235.0"},
+			{[]string{"7", "1"}, "7.0"},
+			{[]string{"x'41'", "1"}, "0.0"},
+			{[]string{"0.5", "0"}, "1.0"},
+			{[]string{"NULL", "1"}, "NULL"},
+			{[]string{"7", "1"}, "7.0"},
+			{[]string{"-2.5", "1"}, "-2.5"},
+			{[]string{"'Hello'", "1"}, "0.0"},
+			{[]string{"x'4142'", "1"}, "0.0"},
+		},
+		"unhex": {
+			{[]string{"NULL"}, "NULL"},
+			{[]string{"7"}, "NULL"},
+			{[]string{"-2.5"}, "NULL"},
+			{[]string{"'Hello'"}, "NULL"},
+			{[]string{"x'4142'"}, "X'AB'"},
+			{[]string{"'4142'"}, "X'4142'"},
+			{[]string{"'41 42'", "' '"}, "X'4142'"},
+			{[]string{"'4G'"}, "NULL"},
+			{[]string{"x'3431'"}, "X'41'"},
+			{[]string{"'4142'", "NULL"}, "NULL"},
+		},
+		"substr": {
+			{[]string{"NULL", "2"}, "NULL"},
+			{[]string{"NULL", "2", "2"}, "NULL"},
+			{[]string{"'Hello'", "NULL"}, "NULL"},
+			{[]string{"'Hello'", "2", "NULL"}, "NULL"},
+			{[]string{"7", "2"}, "''"},
+			{[]string{"7", "2", "2"}, "''"},
+			{[]string{"'Hello'", "7"}, "''"},
+			{[]string{"'Hello'", "2", "7"}, "'ello'"},
+			{[]string{"-2.5", "2"}, "'2.5'"},
+			{[]string{"-2.5", "2", "2"}, "'2.'"},
+			{[]string{"'Hello'", "-2.5"}, "'lo'"},
+			{[]string{"'Hello'", "2", "-2.5"}, "'H'"},
+			{[]string{"'Hello'", "2"}, "'ello'"},
+			{[]string{"'Hello'", "2", "2"}, "'el'"},
+			{[]string{"'Hello'", "'Hello'"}, "'Hello'"},
+			{[]string{"'Hello'", "2", "'Hello'"}, "''"},
+			{[]string{"x'4142'", "2"}, "X'42'"},
+			{[]string{"x'4142'", "2", "2"}, "X'42'"},
+			{[]string{"'Hello'", "x'4142'"}, "'Hello'"},
+			{[]string{"'Hello'", "2", "x'4142'"}, "''"},
+			{[]string{"'abc'", "2", "9223372036854775807"}, "'bc'"},
+			{[]string{"x'616263'", "2", "9223372036854775807"}, "X'6263'"},
+			{[]string{"'abc'", "9223372036854775807", "-9223372036854775807"}, "'abc'"},
+			{[]string{"'Hello'", "-3"}, "'llo'"},
+			{[]string{"'Hello'", "0", "2"}, "'H'"},
+			{[]string{"'Hello'", "-2", "-2"}, "'el'"},
+			{[]string{"x'01020304'", "2", "2"}, "X'0203'"},
+			{[]string{"'héllo'", "2", "2"}, "'él'"},
+		},
+		"instr": {
+			{[]string{"NULL", "'l'"}, "NULL"},
+			{[]string{"'Hello'", "NULL"}, "NULL"},
+			{[]string{"7", "'l'"}, "0"},
+			{[]string{"'Hello'", "7"}, "0"},
+			{[]string{"-2.5", "'l'"}, "0"},
+			{[]string{"'Hello'", "-2.5"}, "0"},
+			{[]string{"'Hello'", "'l'"}, "3"},
+			{[]string{"'Hello'", "'Hello'"}, "1"},
+			{[]string{"x'4142'", "'l'"}, "0"},
+			{[]string{"'Hello'", "x'4142'"}, "0"},
+			{[]string{"x'010203'", "x'0203'"}, "2"},
+			{[]string{"'héllo'", "'l'"}, "3"},
+			{[]string{"'abc'", "''"}, "1"},
+		},
+		"replace": {
+			{[]string{"NULL", "'l'", "'L'"}, "NULL"},
+			{[]string{"'Hello'", "NULL", "'x'"}, "NULL"},
+			{[]string{"'Hello'", "'l'", "NULL"}, "NULL"},
+			{[]string{"7", "'l'", "'L'"}, "'7'"},
+			{[]string{"'Hello'", "7", "'x'"}, "'Hello'"},
+			{[]string{"'Hello'", "'l'", "7"}, "'He77o'"},
+			{[]string{"-2.5", "'l'", "'L'"}, "'-2.5'"},
+			{[]string{"'Hello'", "-2.5", "'x'"}, "'Hello'"},
+			{[]string{"'Hello'", "'l'", "-2.5"}, "'He-2.5-2.5o'"},
+			{[]string{"'Hello'", "'l'", "'L'"}, "'HeLLo'"},
+			{[]string{"'Hello'", "'Hello'", "'x'"}, "'x'"},
+			{[]string{"'Hello'", "'l'", "'Hello'"}, "'HeHelloHelloo'"},
+			{[]string{"x'4142'", "'l'", "'L'"}, "'AB'"},
+			{[]string{"'Hello'", "x'4142'", "'x'"}, "'Hello'"},
+			{[]string{"'Hello'", "'l'", "x'4142'"}, "'HeABABo'"},
+			{[]string{"'aaa'", "''", "'b'"}, "'aaa'"},
+			{[]string{"7.5", "'.'", "','"}, "'7,5'"},
+		},
+		"coalesce": {
+			{[]string{"NULL", "NULL"}, "NULL"},
+			{[]string{"NULL", "'d'"}, "'d'"},
+			{[]string{"NULL", "7"}, "7"},
+			{[]string{"7", "'d'"}, "7"},
+			{[]string{"NULL", "-2.5"}, "-2.5"},
+			{[]string{"-2.5", "'d'"}, "-2.5"},
+			{[]string{"NULL", "'Hello'"}, "'Hello'"},
+			{[]string{"'Hello'", "'d'"}, "'Hello'"},
+			{[]string{"NULL", "x'4142'"}, "X'4142'"},
+			{[]string{"x'4142'", "'d'"}, "X'4142'"},
+			{[]string{"NULL", "NULL"}, "NULL"},
+			{[]string{"NULL", "NULL", "3"}, "3"},
+		},
+		"ifnull": {
+			{[]string{"NULL", "'d'"}, "'d'"},
+			{[]string{"7", "'d'"}, "7"},
+			{[]string{"-2.5", "'d'"}, "-2.5"},
+			{[]string{"'Hello'", "'d'"}, "'Hello'"},
+			{[]string{"x'4142'", "'d'"}, "X'4142'"},
+		},
+		"nullif": {
+			{[]string{"NULL", "7"}, "NULL"},
+			{[]string{"NULL", "'Hello'"}, "NULL"},
+			{[]string{"7", "7"}, "NULL"},
+			{[]string{"7", "'Hello'"}, "7"},
+			{[]string{"-2.5", "7"}, "-2.5"},
+			{[]string{"-2.5", "'Hello'"}, "-2.5"},
+			{[]string{"'Hello'", "7"}, "'Hello'"},
+			{[]string{"'Hello'", "'Hello'"}, "NULL"},
+			{[]string{"x'4142'", "7"}, "X'4142'"},
+			{[]string{"x'4142'", "'Hello'"}, "X'4142'"},
+			{[]string{"7", "7.0"}, "NULL"},
+			{[]string{"'7'", "7"}, "'7'"},
+		},
+		"iif": {
+			{[]string{"NULL", "'y'", "'n'"}, "'n'"},
+			{[]string{"7", "'y'", "'n'"}, "'y'"},
+			{[]string{"-2.5", "'y'", "'n'"}, "'y'"},
+			{[]string{"'Hello'", "'y'", "'n'"}, "'n'"},
+			{[]string{"x'4142'", "'y'", "'n'"}, "'n'"},
+			{[]string{"0", "'y'"}, "NULL"},
+			{[]string{"'1x'", "'y'", "'n'"}, "'y'"},
+			{[]string{"0.1", "'y'", "'n'"}, "'y'"},
+		},
+		"min": {
+			{[]string{"NULL", "3"}, "NULL"},
+			{[]string{"NULL", "'a'"}, "NULL"},
+			{[]string{"7", "3"}, "3"},
+			{[]string{"7", "'a'"}, "7"},
+			{[]string{"-2.5", "3"}, "-2.5"},
+			{[]string{"-2.5", "'a'"}, "-2.5"},
+			{[]string{"'Hello'", "3"}, "3"},
+			{[]string{"'Hello'", "'a'"}, "'Hello'"},
+			{[]string{"x'4142'", "3"}, "3"},
+			{[]string{"x'4142'", "'a'"}, "'a'"},
+			{[]string{"1", "NULL", "'a'"}, "NULL"},
+			{[]string{"2.5", "2", "x'00'", "'z'"}, "2"},
+		},
+		"max": {
+			{[]string{"NULL", "3"}, "NULL"},
+			{[]string{"NULL", "x'00'"}, "NULL"},
+			{[]string{"7", "3"}, "7"},
+			{[]string{"7", "x'00'"}, "X'00'"},
+			{[]string{"-2.5", "3"}, "3"},
+			{[]string{"-2.5", "x'00'"}, "X'00'"},
+			{[]string{"'Hello'", "3"}, "'Hello'"},
+			{[]string{"'Hello'", "x'00'"}, "X'00'"},
+			{[]string{"x'4142'", "3"}, "X'4142'"},
+			{[]string{"x'4142'", "x'00'"}, "X'4142'"},
+			{[]string{"1", "NULL", "'a'"}, "NULL"},
+			{[]string{"2.5", "2", "x'00'", "'z'"}, "X'00'"},
+		},
+		"printf": {
+			{[]string{"'%d|%s|%.2f|%x'", "NULL", "NULL", "NULL", "NULL"}, "'0||0.00|0'"},
+			{[]string{"'%d|%s|%.2f|%x'", "7", "7", "7", "7"}, "'7|7|7.00|7'"},
+			{[]string{"'%d|%s|%.2f|%x'", "-2.5", "-2.5", "-2.5", "-2.5"}, "'-2|-2.5|-2.50|fffffffffffffffe'"},
+			{[]string{"'%d|%s|%.2f|%x'", "'Hello'", "'Hello'", "'Hello'", "'Hello'"}, "'0|Hello|0.00|0'"},
+			{[]string{"'%d|%s|%.2f|%x'", "x'4142'", "x'4142'", "x'4142'", "x'4142'"}, "'0|AB|0.00|0'"},
+			{[]string{"NULL", "1"}, "NULL"},
+			{[]string{"'%5.1f|%-4d|%05d|%c'", "3.14159", "7", "42", "'xyz'"}, "'  3.1|7   |00042|x'"},
+			{[]string{"'%s %s'", "'only'"}, "'only '"},
+			{[]string{"'%lld %%'", "'12abc'"}, "'12 %'"},
+			{[]string{"'%e|%g'", "1234.5", "0.0001"}, "'1.234500e+03|0.0001'"},
+		},
+		"format": {
+			{[]string{"'%q|%Q|%w'", "NULL", "NULL", "NULL"}, "'(NULL)|NULL|(NULL)'"},
+			{[]string{"'%q|%Q|%w'", "7", "7", "7"}, "'7|''7''|7'"},
+			{[]string{"'%q|%Q|%w'", "-2.5", "-2.5", "-2.5"}, "'-2.5|''-2.5''|-2.5'"},
+			{[]string{"'%q|%Q|%w'", "'Hello'", "'Hello'", "'Hello'"}, "'Hello|''Hello''|Hello'"},
+			{[]string{"'%q|%Q|%w'", "x'4142'", "x'4142'", "x'4142'"}, "'AB|''AB''|AB'"},
+		},
+		"likelihood": {
+			{[]string{"NULL", "0.5"}, "NULL"},
+			{[]string{"7", "0.5"}, "7"},
+			{[]string{"-2.5", "0.5"}, "-2.5"},
+			{[]string{"'Hello'", "0.5"}, "'Hello'"},
+			{[]string{"x'4142'", "0.5"}, "X'4142'"},
+		},
+	}
+	for name, fnCases := range cases {
+		fn, ok := scalarFunctions[name]
+		if !ok {
+			t.Errorf("no function %s", name)
+			continue
+		}
+		for _, c := range fnCases {
+			call := name + "(" + strings.Join(c.args, ", ") + ")"
+			if len(c.args) < fn.minArgs || (fn.maxArgs >= 0 && len(c.args) > fn.maxArgs) {
+				t.Errorf("%s: wrong number of arguments", call)
+				continue
+			}
+			args := make([]btree.Value, len(c.args))
+			for a, literal := range c.args {
+				args[a] = literalValue(t, literal)
+			}
+			got, err := fn.call(args)
+			if err != nil {
+				t.Errorf("%s failed: %v", call, err)
+				continue
+			}
+			if quoted := quoteValue(got); quoted != c.want {
+				t.Errorf("%s = %s, want %s", call, quoted, c.want)
+			}
+		}
+	}
+}
+
+func TestScalarFunctionErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []btree.Value
+		want string
+	}{
+		{"abs", []btree.Value{btree.IntegerValue(-1 << 63)}, "integer overflow"},
+		{"zeroblob", []btree.Value{btree.IntegerValue(MAX_VALUE_LENGTH + 1)}, "string or blob too big"},
+		{"randomblob", []btree.Value{btree.IntegerValue(MAX_VALUE_LENGTH + 1)}, "string or blob too big"},
+	}
+	for _, c := range cases {
+		_, err := scalarFunctions[c.name].call(c.args)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s(%v) error = %v, want %q", c.name, c.args, err, c.want)
+		}
+	}
+}
+
+// random() and randomblob() can only be checked by type and size.
+func TestRandomFunctions(t *testing.T) {
+	v, err := fnRandom(nil)
+	if err != nil || v.Class() != btree.IntegerClass {
+		t.Errorf("random() = %v (%s), %v; want an integer", v, v.Class(), err)
+	}
+	for _, c := range []struct {
+		arg  btree.Value
+		size int
+	}{
+		{btree.NullValue(), 1}, {btree.IntegerValue(16), 16}, {btree.IntegerValue(-5), 1},
+		{btree.RealValue(3.9), 3}, {btree.TextValue("4"), 4}, {btree.TextValue("abc"), 1},
+	} {
+		v, err := fnRandomblob([]btree.Value{c.arg})
+		if err != nil || v.Class() != btree.BlobClass || len(v.Bytes()) != c.size {
+			t.Errorf("randomblob(%s) = %v (%s), %v; want a blob of %d bytes", quoteValue(c.arg), v, v.Class(), err, c.size)
+		}
+	}
+}
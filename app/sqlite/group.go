@@ -0,0 +1,427 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// A SELECT with aggregate functions, GROUP BY or HAVING.
+type aggregateQuery struct {
+	stmt        *sql.SelectStatement
+	plan        *joinPlan
+	columnTexts []string
+	explain     *queryPlan // see selectAllRows
+}
+
+func isAggregateQuery(stmt *sql.SelectStatement) bool {
+	if len(stmt.GroupByExprs) > 0 || stmt.HavingExpr != nil {
+		return true
+	}
+	for _, column := range stmt.Columns {
+		if hasAggregate(column.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run an aggregate query. Rows are grouped while being read when they arrive in GROUP BY order (rowid or index),
+// otherwise through a hash table that spills the rows of groups that do not fit in memory to the sorter.
+// Either way the groups come out ordered by the GROUP BY keys, like SQLite does.
+func (d *Db) aggregateRows(q *aggregateQuery, limit int64, offset int64) (*Rows, error) {
+	sources := q.plan.sources
+	aggregates := &aggregateSet{sources: len(sources)}
+	aliases := resultAliases(q.stmt.Columns)
+	sc := &scope{sources: sources, aggregates: aggregates, aliases: aliases}
+
+	results, colNames, err := compileResultColumns(q.stmt.Columns, sc, q.columnTexts)
+	if err != nil {
+		return nil, err
+	}
+
+	// GROUP BY terms are evaluated per row; an integer literal refers to a result column.
+	rowScope := &scope{sources: sources, aliases: aliases}
+	groupExprs := make([]sql.Expr, len(q.stmt.GroupByExprs))
+	groupBy := make([]evaluator, len(q.stmt.GroupByExprs))
+	groupKeys := make([]orderingKey, len(q.stmt.GroupByExprs))
+	for g, expr := range q.stmt.GroupByExprs {
+		if lit, ok := expr.(*sql.NumberLit); ok {
+			if n, err := numberLiteral(lit.Value); err == nil && n.Class() == btree.IntegerClass {
+				if n.Integer() < 1 || n.Integer() > int64(len(q.stmt.Columns)) {
+					return nil, fmt.Errorf("%s GROUP BY term out of range - should be between 1 and %d", ordinal(g+1), len(q.stmt.Columns))
+				}
+				expr = q.stmt.Columns[n.Integer()-1].Expr
+			}
+		}
+		if hasAggregate(expr) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in the GROUP BY clause")
+		}
+		ev, _, err := compileExpr(expr, rowScope)
+		if err != nil {
+			return nil, err
+		}
+		groupExprs[g] = expr
+		groupBy[g] = ev
+		groupKeys[g] = orderingKey{eval: ev, column: -1, nullsFirst: true}
+		// values equal by the collation of a column are one group. (e.g. 'a' and 'A' of a NOCASE column)
+		groupKeys[g].collation, _ = exprCollation(expr, rowScope)
+		if si, ci, ok := columnReference(expr, rowScope); ok && si == 0 {
+			groupKeys[g].column = ci
+		}
+	}
+
+	var having evaluator
+	if q.stmt.HavingExpr != nil {
+		if having, _, err = compileExpr(q.stmt.HavingExpr, sc); err != nil {
+			return nil, err
+		}
+	}
+	orderBy, err := compileOrderBy(q.stmt.OrderingTerms, sc, results)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows of the groups are what is distinct, not the rows read.
+	distinct := q.stmt.Distinct.IsValid()
+
+	// Read the rows in GROUP BY order when the (first) table already keeps them that way.
+	// like sqlite3, the groups then come in the order read. (e.g. descending for DESC index columns)
+	streamed, sortGroups := len(groupBy) == 0, len(orderBy) > 0
+	if len(groupBy) > 0 {
+		if keys, ok := groupOrderKeys(q.stmt.OrderingTerms, groupExprs, groupKeys); ok && !q.plan.orderBy(keys) {
+			debugf("rows in ORDER BY order, so are the groups\n")
+			streamed, sortGroups = true, false
+		} else {
+			streamed = q.plan.groupBy(groupKeys)
+			// hashed groups come out in GROUP BY order.
+			sortGroups = sortGroups && (streamed || !orderedByGroups(q.stmt.OrderingTerms, groupExprs))
+		}
+	}
+	if q.explain != nil {
+		if err := d.explainViews(q.plan, q.explain); err != nil {
+			return nil, err
+		}
+		q.explain.add(q.plan.explain()...)
+		if !streamed {
+			q.explain.add("USE TEMP B-TREE FOR GROUP BY")
+		}
+		if distinct {
+			q.explain.add("USE TEMP B-TREE FOR DISTINCT")
+		}
+		if sortGroups {
+			q.explain.add("USE TEMP B-TREE FOR ORDER BY")
+		}
+		return nil, nil
+	}
+	rows, err := q.plan.firstRows()
+	if err != nil {
+		return nil, err
+	}
+
+	envs := q.plan.envs(rows)
+	keyed := func() ([]btree.Value, []Row, bool, error) {
+		env, ok, err := envs.next()
+		if !ok || err != nil {
+			return nil, nil, false, err
+		}
+		key := make([]btree.Value, len(groupBy))
+		for g, ev := range groupBy {
+			v, err := ev(env)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			key[g] = v
+		}
+		return key, env.rows, true, nil
+	}
+	var groups *groupIterator
+	if streamed {
+		groups = streamGroups(aggregates, groupKeys, keyed, envs.close, len(groupBy) == 0)
+	} else {
+		h := &hashAggregation{
+			aggregates:  aggregates,
+			sources:     sources,
+			keys:        groupKeys,
+			memoryLimit: d.sortMemory,
+		}
+		groups = h.groups(keyed, envs.close)
+	}
+
+	src := groups.envs(having)
+	var result *Rows
+	if sortGroups {
+		result = d.sortedRows(colNames, src, orderBy, results, topNOf(limit, offset))
+	} else {
+		result = projectedRows(colNames, src, results)
+	}
+	if distinct {
+		result = distinctRows(result, distinctKeys(results), false)
+	}
+	return result, nil
+}
+
+// Whether ORDER BY is a prefix of the GROUP BY terms, in the order the groups come out already.
+func orderedByGroups(terms []*sql.OrderingTerm, groupExprs []sql.Expr) bool {
+	if len(terms) > len(groupExprs) {
+		return false
+	}
+	for t, term := range terms {
+		if term.Desc.IsValid() || term.NullsLast.IsValid() || term.X.String() != groupExprs[t].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// The ORDER BY terms as keys of the rows being grouped, when they are the first GROUP BY terms; the remaining
+// GROUP BY terms follow in ascending order, for the groups to come together.
+func groupOrderKeys(terms []*sql.OrderingTerm, groupExprs []sql.Expr, groupKeys []orderingKey) ([]orderingKey, bool) {
+	if len(terms) == 0 || len(terms) > len(groupExprs) {
+		return nil, false
+	}
+	keys := append([]orderingKey{}, groupKeys...)
+	for t, term := range terms {
+		if term.X.String() != groupExprs[t].String() {
+			return nil, false
+		}
+		keys[t].desc = term.Desc.IsValid()
+		keys[t].nullsFirst = !keys[t].desc
+		if term.NullsFirst.IsValid() {
+			keys[t].nullsFirst = true
+		} else if term.NullsLast.IsValid() {
+			keys[t].nullsFirst = false
+		}
+	}
+	return keys, true
+}
+
+// Produces rows (one of each table) along with their GROUP BY key.
+type keyedRows func() (key []btree.Value, rows []Row, ok bool, err error)
+
+// Completed groups, one at a time.
+type groupIterator struct {
+	next   func() (*groupState, bool, error)
+	close  func() error
+	closed bool
+}
+
+func (it *groupIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	return it.close()
+}
+
+// Groups that pass HAVING, as what the result columns are evaluated against.
+func (it *groupIterator) envs(having evaluator) *envIterator {
+	return &envIterator{
+		next: func() (*evalEnv, bool, error) {
+			for {
+				g, ok, err := it.next()
+				if !ok || err != nil {
+					return nil, false, err
+				}
+				env := g.env()
+				if having != nil {
+					v, err := having(env)
+					if err != nil {
+						return nil, false, err
+					}
+					if isTrue, _ := truth(v); !isTrue {
+						continue
+					}
+				}
+				return env, true, nil
+			}
+		},
+		close: it.Close,
+	}
+}
+
+func sameKey(keys []orderingKey, a []btree.Value, b []btree.Value) bool {
+	for i := range a {
+		if btree.CompareCollated(a[i], b[i], keys[i].collation) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Group rows that arrive ordered by their key; a group is complete once the key changes.
+// With `single` all rows make one group, which exists even when there are no rows at all.
+func streamGroups(aggregates *aggregateSet, keys []orderingKey, rows keyedRows, close func() error, single bool) *groupIterator {
+	minMax := aggregates.minMax()
+	var pending *groupState // first row of the next group, read while completing the current one.
+	done := false
+	return &groupIterator{
+		next: func() (*groupState, bool, error) {
+			if done {
+				return nil, false, nil
+			}
+			current := pending
+			pending = nil
+			for {
+				key, joined, ok, err := rows()
+				if err != nil {
+					return nil, false, err
+				}
+				if !ok {
+					done = true
+					if current == nil && single {
+						current = aggregates.newGroup(nil)
+					}
+					return current, current != nil, nil
+				}
+				if current != nil && !sameKey(keys, current.key, key) {
+					pending = aggregates.newGroup(key)
+					if err := aggregates.step(pending, joined, minMax); err != nil {
+						return nil, false, err
+					}
+					return current, true, nil
+				}
+				if current == nil {
+					current = aggregates.newGroup(key)
+				}
+				if err := aggregates.step(current, joined, minMax); err != nil {
+					return nil, false, err
+				}
+			}
+		},
+		close: close,
+	}
+}
+
+// Group rows in any order with a hash table keyed by the GROUP BY values.
+//
+// Once the groups use up `memoryLimit`, rows of groups that are not in the table yet go to the sorter
+// (key, then rowid and all columns of each table) and are grouped while being read back in order.
+type hashAggregation struct {
+	aggregates  *aggregateSet
+	sources     []sourceTable
+	keys        []orderingKey
+	collations  []string // of the keys
+	memoryLimit int
+	groupMap    map[string]*groupState
+	memory      int
+	spill       *sorter
+}
+
+func (h *hashAggregation) add(key []btree.Value, rows []Row, minMax int) error {
+	hashKey := valuesKey(key, h.collations)
+	g, ok := h.groupMap[hashKey]
+	if !ok {
+		record := joinedRecord(h.sources, rows)
+		if h.memory >= h.memoryLimit {
+			if h.spill == nil {
+				debugf("GROUP BY exceeded %d bytes with %d groups, spilling rows of new groups\n", h.memoryLimit, len(h.groupMap))
+				h.spill = newSorter(compareByKeys(h.keys), h.memoryLimit)
+			}
+			return h.spill.add(append(key, record...))
+		}
+		// keep a copy of the rows, the cells may not outlive the page they were read from.
+		g = h.aggregates.newGroup(key)
+		h.groupMap[hashKey] = g
+		h.memory += recordSize(key) + recordSize(record) + 64*len(g.aggregators)
+		rows = joinedRows(h.sources, record)
+	}
+	return h.aggregates.step(g, rows, minMax)
+}
+
+func (h *hashAggregation) groups(rows keyedRows, close func() error) *groupIterator {
+	if h.memoryLimit <= 0 {
+		h.memoryLimit = DEFAULT_SORT_MEMORY
+	}
+	h.groupMap = map[string]*groupState{}
+	for _, key := range h.keys {
+		h.collations = append(h.collations, key.collation)
+	}
+	minMax := h.aggregates.minMax()
+	compare := compareByKeys(h.keys)
+
+	var inMemory []*groupState
+	var spilled *groupIterator
+	var spilledGroup *groupState // next group from the spilled rows, nil when there is none.
+	loaded := false
+	load := func() error {
+		loaded = true
+		defer close()
+		for {
+			key, joined, ok, err := rows()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			if err := h.add(key, joined, minMax); err != nil {
+				return err
+			}
+		}
+		for _, g := range h.groupMap {
+			inMemory = append(inMemory, g)
+		}
+		h.groupMap = nil
+		sort.Slice(inMemory, func(i, j int) bool {
+			return compare(inMemory[i].key, inMemory[j].key) < 0
+		})
+		if h.spill == nil {
+			return nil
+		}
+		sorted, err := h.spill.finish()
+		if err != nil {
+			return err
+		}
+		n := len(h.keys)
+		spilledRows := func() ([]btree.Value, []Row, bool, error) {
+			record, ok, err := sorted.next()
+			if !ok || err != nil {
+				return nil, nil, false, err
+			}
+			return record[:n], joinedRows(h.sources, record[n:]), true, nil
+		}
+		spilled = streamGroups(h.aggregates, h.keys, spilledRows, sorted.close, false)
+		spilledGroup, _, err = spilled.next()
+		return err
+	}
+	return &groupIterator{
+		next: func() (*groupState, bool, error) {
+			if !loaded {
+				if err := load(); err != nil {
+					return nil, false, err
+				}
+			}
+			// merge both ordered sets of groups; they never share a key.
+			if spilledGroup != nil && (len(inMemory) == 0 || compare(spilledGroup.key, inMemory[0].key) < 0) {
+				g := spilledGroup
+				var err error
+				if spilledGroup, _, err = spilled.next(); err != nil {
+					return nil, false, err
+				}
+				return g, true, nil
+			}
+			if len(inMemory) == 0 {
+				return nil, false, nil
+			}
+			g := inMemory[0]
+			inMemory = inMemory[1:]
+			return g, true, nil
+		},
+		close: func() error {
+			inMemory = nil
+			if spilled != nil {
+				return spilled.Close()
+			}
+			if h.spill != nil {
+				return h.spill.close()
+			}
+			if !loaded {
+				return close()
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,293 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// A position within one page of an index b-tree.
+//
+// The entries of an interior page come between its child pages: step 2j is the left page of cell j (2n the right most
+// pointer), step 2j+1 the cell j itself. A leaf page only has cells, step j is cell j.
+type indexCursorFrame struct {
+	pageNumber int64
+	page       *btree.TableBTreePage
+	step       int // next step to take, -1 or past the last when the page is done.
+}
+
+// Walk through the entries of an index b-tree in index order, or backwards, loading pages only when they are reached.
+// Like Cursor only the pages from the root down to the current entry are held at any time.
+//
+//	cur := idx.NewIndexCursor(nil, false)
+//	defer cur.Close()
+//	for cur.Next() {
+//		fmt.Println(cur.Entry()[0].Value())
+//	}
+//	if err := cur.Err(); err != nil { ... }
+type IndexCursor struct {
+	index   *DBIndex
+	seek    *indexSeek // nil for every entry.
+	reverse bool
+	stack   []indexCursorFrame
+	fields  []btree.TableBTreeLeafPageCellField
+	started bool
+	err     error
+}
+
+// A cursor over the entries of the seek (nil for all of them), the first one is found by binary search.
+func (i *DBIndex) NewIndexCursor(seek *indexSeek, reverse bool) *IndexCursor {
+	return &IndexCursor{
+		index:   i,
+		seek:    seek,
+		reverse: reverse,
+		stack:   make([]indexCursorFrame, 0, 4),
+	}
+}
+
+// Move to the next entry; false when the seek is exhausted (or an error occurred, see Err()).
+func (c *IndexCursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if !c.started {
+		c.started = true
+		if err := c.push(int64(c.index.rootPage)); err != nil {
+			return c.fail(err)
+		}
+		if c.seek != nil {
+			if err := c.position(); err != nil {
+				return c.fail(err)
+			}
+		}
+	}
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		page := top.page
+		step := top.step
+		if c.reverse {
+			top.step--
+		} else {
+			top.step++
+		}
+		switch page.Header.PageType {
+		case btree.LeafIndex:
+			if step < 0 || step >= len(page.CellOffsets) {
+				c.pop()
+				continue
+			}
+			cell, err := page.ReadIndexLeafCell(step)
+			if err != nil {
+				return c.fail(c.index.db.pageError(top.pageNumber, err))
+			}
+			return c.entry(top.pageNumber, cell.Fields())
+		case btree.InteriorIndex:
+			if step < 0 || step > 2*len(page.CellOffsets) {
+				c.pop()
+				continue
+			}
+			if step == 2*len(page.CellOffsets) {
+				if err := c.push(int64(page.Header.RightMostPointer)); err != nil {
+					return c.fail(err)
+				}
+				continue
+			}
+			cell, err := page.ReadIndexInteriorCell(page.CellOffsets[step/2])
+			if err != nil {
+				return c.fail(c.index.db.pageError(top.pageNumber, err))
+			}
+			if step%2 == 1 {
+				return c.entry(top.pageNumber, cell.Fields())
+			}
+			if err := c.push(int64(cell.LeftPageNumber)); err != nil {
+				return c.fail(err)
+			}
+		default:
+			return c.fail(newPageError(ErrCorrupt, top.pageNumber, 0, fmt.Errorf("unexpected page type %#x in index b-tree", page.Header.PageType)))
+		}
+	}
+	c.fields = nil
+	return false
+}
+
+// Make the fields the current entry, unless they are past the end of the seek. (its start going backwards)
+func (c *IndexCursor) entry(pageNumber int64, fields []btree.TableBTreeLeafPageCellField) bool {
+	if c.seek != nil && ((!c.reverse && c.index.afterSeek(c.seek, fields)) || (c.reverse && c.index.beforeSeek(c.seek, fields))) {
+		c.stack = nil
+		c.fields = nil
+		return false
+	}
+	if !c.index.withoutRowid && len(fields) <= len(c.index.columns) {
+		return c.fail(newPageError(ErrCorrupt, pageNumber, 0, fmt.Errorf("index %s entry has %d fields, expected %d", c.index.Name(), len(fields), len(c.index.columns)+1)))
+	}
+	c.fields = fields
+	return true
+}
+
+// Position the cursor on the path down to the first entry of the seek; the last one going backwards.
+func (c *IndexCursor) position() error {
+	for {
+		top := &c.stack[len(c.stack)-1]
+		page := top.page
+		var readErr error
+		// the first cell past the cells to skip; those before the seek, or when going backwards all but the ones after it.
+		past := func(fields []btree.TableBTreeLeafPageCellField) bool {
+			if c.reverse {
+				return c.index.afterSeek(c.seek, fields)
+			}
+			return !c.index.beforeSeek(c.seek, fields)
+		}
+		switch page.Header.PageType {
+		case btree.LeafIndex:
+			j := sort.Search(len(page.CellOffsets), func(j int) bool {
+				cell, err := page.ReadIndexLeafCell(j)
+				if err != nil {
+					readErr = err
+					return true
+				}
+				return past(cell.Fields())
+			})
+			if readErr != nil {
+				return c.index.db.pageError(top.pageNumber, readErr)
+			}
+			top.step = j
+			if c.reverse {
+				top.step = j - 1
+			}
+			return nil
+		case btree.InteriorIndex:
+			j := sort.Search(len(page.CellOffsets), func(j int) bool {
+				cell, err := page.ReadIndexInteriorCell(page.CellOffsets[j])
+				if err != nil {
+					readErr = err
+					return true
+				}
+				return past(cell.Fields())
+			})
+			if readErr != nil {
+				return c.index.db.pageError(top.pageNumber, readErr)
+			}
+			// the seek starts (ends going backwards) within the left page of cell j, or the right most page.
+			top.step = 2*j + 1
+			if c.reverse {
+				top.step = 2*j - 1
+			}
+			child := int64(page.Header.RightMostPointer)
+			if j < len(page.CellOffsets) {
+				cell, err := page.ReadIndexInteriorCell(page.CellOffsets[j])
+				if err != nil {
+					return c.index.db.pageError(top.pageNumber, err)
+				}
+				child = int64(cell.LeftPageNumber)
+			}
+			if err := c.push(child); err != nil {
+				return err
+			}
+		default:
+			return newPageError(ErrCorrupt, top.pageNumber, 0, fmt.Errorf("unexpected page type %#x in index b-tree", page.Header.PageType))
+		}
+	}
+}
+
+// Enter a page at its first step, its last one going backwards.
+func (c *IndexCursor) push(pageNumber int64) error {
+	if len(c.stack) >= MAX_BTREE_DEPTH {
+		return newPageError(ErrCorrupt, pageNumber, 0, fmt.Errorf("index b-tree of %s is deeper than %d pages", c.index.Name(), MAX_BTREE_DEPTH))
+	}
+	page, err := c.index.db.readPage(pageNumber - 1)
+	if err != nil {
+		return err
+	}
+	frame := indexCursorFrame{pageNumber: pageNumber, page: page}
+	if c.reverse {
+		frame.step = len(page.CellOffsets) - 1
+		if page.Header.PageType == btree.InteriorIndex {
+			frame.step = 2 * len(page.CellOffsets)
+		}
+	}
+	c.stack = append(c.stack, frame)
+	return nil
+}
+
+func (c *IndexCursor) pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+func (c *IndexCursor) fail(err error) bool {
+	c.err = err
+	c.fields = nil
+	c.stack = nil
+	return false
+}
+
+// The fields of the current entry.
+func (c *IndexCursor) Entry() []btree.TableBTreeLeafPageCellField {
+	return c.fields
+}
+
+func (c *IndexCursor) Err() error {
+	return c.err
+}
+
+func (c *IndexCursor) Close() error {
+	c.stack = nil
+	c.fields = nil
+	return nil
+}
+
+// The entries of the seeks one after the other, each walked by its own IndexCursor. Backwards the seeks are taken
+// from the last one, so the entries come in reverse index order.
+type seekCursor struct {
+	index   *DBIndex
+	seeks   []indexSeek
+	reverse bool
+	cursor  *IndexCursor
+	err     error
+}
+
+func (i *DBIndex) newSeekCursor(seeks []indexSeek, reverse bool) *seekCursor {
+	return &seekCursor{index: i, seeks: seeks, reverse: reverse}
+}
+
+func (s *seekCursor) Next() bool {
+	for s.err == nil {
+		if s.cursor != nil && s.cursor.Next() {
+			return true
+		}
+		if s.cursor != nil {
+			s.err = s.cursor.Err()
+			s.cursor = nil
+			continue
+		}
+		if len(s.seeks) == 0 {
+			return false
+		}
+		seek := &s.seeks[0]
+		if s.reverse {
+			seek = &s.seeks[len(s.seeks)-1]
+			s.seeks = s.seeks[:len(s.seeks)-1]
+		} else {
+			s.seeks = s.seeks[1:]
+		}
+		s.cursor = s.index.NewIndexCursor(seek, s.reverse)
+	}
+	return false
+}
+
+func (s *seekCursor) Entry() []btree.TableBTreeLeafPageCellField {
+	if s.cursor == nil {
+		return nil
+	}
+	return s.cursor.Entry()
+}
+
+func (s *seekCursor) Err() error {
+	return s.err
+}
+
+func (s *seekCursor) Close() error {
+	s.seeks = nil
+	s.cursor = nil
+	return nil
+}
@@ -0,0 +1,547 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// How a table of the FROM clause joins the tables before it.
+type joinOperator struct {
+	left    bool     // LEFT JOIN; a row of NULLs when nothing matches.
+	natural bool     // NATURAL JOIN; USING all the columns both sides have.
+	on      sql.Expr // may be nil.
+	using   []string
+}
+
+// Tables of the FROM clause in join order, along with how each one joins the ones before it. (the first one's is unused)
+func (d *Db) fromSources(source sql.Source) ([]sourceTable, []joinOperator, error) {
+	switch source := source.(type) {
+	case *sql.QualifiedTableName:
+		tbl, ok := d.Table(source.Name.Name)
+		if view, isView := d.View(source.Name.Name); !ok && isView {
+			var err error
+			if tbl, err = d.viewTable(view); err != nil {
+				return nil, nil, err
+			}
+			ok = true
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown table %s", source.Name.Name)
+		}
+		// as written, the name of a schema table may differ in case.
+		src := sourceTable{name: source.Name.Name, table: tbl, used: map[int]bool{}}
+		if source.Alias != nil {
+			src.name = source.Alias.Name
+		}
+		return []sourceTable{src}, []joinOperator{{}}, nil
+	case *sql.ParenSource:
+		return d.fromSources(source.X)
+	case *sql.JoinClause:
+		sources, joins, err := d.fromSources(source.X)
+		if err != nil {
+			return nil, nil, err
+		}
+		right, rightJoins, err := d.fromSources(source.Y)
+		if err != nil {
+			return nil, nil, err
+		}
+		join := joinOperator{left: source.Operator.Left.IsValid(), natural: source.Operator.Natural.IsValid()}
+		if join.left && leadingParenJoin(source.Y) {
+			return nil, nil, fmt.Errorf("LEFT JOIN of a parenthesized join is not yet supported")
+		}
+		switch constraint := source.Constraint.(type) {
+		case *sql.OnConstraint:
+			join.on = constraint.X
+		case *sql.UsingConstraint:
+			for _, col := range constraint.Columns {
+				join.using = append(join.using, col.Name)
+			}
+		}
+		if join.natural && source.Constraint != nil {
+			return nil, nil, fmt.Errorf("a NATURAL join may not have an ON or USING clause")
+		}
+		// `a JOIN b JOIN c` comes nested as `a JOIN (b JOIN c)`; the operator belongs to the first table on the right.
+		rightJoins[0] = join
+		return append(sources, right...), append(joins, rightJoins...), nil
+	}
+	return nil, nil, fmt.Errorf("'%s' in FROM is not yet supported", source)
+}
+
+// Whether the leftmost table of the source is a parenthesized join, e.g. `(b JOIN c)`.
+func leadingParenJoin(source sql.Source) bool {
+	for {
+		switch s := source.(type) {
+		case *sql.JoinClause:
+			source = s.X
+		case *sql.ParenSource:
+			_, ok := s.X.(*sql.JoinClause)
+			return ok
+		default:
+			return false
+		}
+	}
+}
+
+// The FROM and WHERE clauses, planned as a nested loop: the rows of the first table are read (looked up by
+// its WHERE terms when possible), the following tables are read again for every combination of rows before them.
+// Each WHERE term is checked as soon as the tables it refers to have a row.
+//
+// How each table is read (see accessPath) is only chosen once the whole query is compiled, so that the columns
+// it reads are known. (see choose)
+type joinPlan struct {
+	sources []sourceTable
+	// first table; the constraints of its WHERE terms (see columnConstraints) and the WHERE terms that only refer to it.
+	where     map[string]*columnConstraint
+	predicate evaluator
+	path      *accessPath
+	// following tables, one per source after the first.
+	levels []*joinLevel
+}
+
+// A table joined to the ones before it.
+type joinLevel struct {
+	left    bool
+	on      evaluator    // nil without ON/USING.
+	lookups []joinLookup // equality terms that find the matching rows through the rowid or an index; none means a scan.
+	filter  evaluator    // WHERE terms that refer to this table (and maybe the ones before it)
+	path    accessPath
+}
+
+// `column = value` where the value only depends on the tables before.
+type joinLookup struct {
+	column   int
+	value    evaluator
+	affinity btree.Affinity // applied to the value before the lookup, like the comparison would.
+	// the comparison's, see comparisonCollation(); an index of another collation is only of use when it is BINARY.
+	collation string
+}
+
+func planJoin(sources []sourceTable, joins []joinOperator, whereExpr sql.Expr, aliases map[string]sql.Expr) (*joinPlan, error) {
+	ons := make([]sql.Expr, len(sources))
+	for i := 1; i < len(sources); i++ {
+		on, err := usingTerms(sources, i, joins[i])
+		if err != nil {
+			return nil, err
+		}
+		if joins[i].on != nil {
+			on = append(on, joins[i].on)
+		}
+		ons[i] = conjunction(on)
+	}
+
+	// WHERE terms by the last table they refer to.
+	sc := &scope{sources: sources, aliases: aliases}
+	termExprs := make([][]sql.Expr, len(sources))
+	terms := make([][]evaluator, len(sources))
+	for _, term := range conjuncts(whereExpr) {
+		level := 0
+		ev, _, err := compileExpr(term, sc.recordingLevel(&level))
+		if err != nil {
+			return nil, err
+		}
+		termExprs[level] = append(termExprs[level], term)
+		terms[level] = append(terms[level], ev)
+	}
+
+	first := sources[0]
+	p := &joinPlan{
+		sources:   sources,
+		where:     first.table.columnConstraints(conjunction(termExprs[0]), first.name),
+		predicate: allTrue(terms[0]),
+	}
+
+	for i := 1; i < len(sources); i++ {
+		// ON may refer to this table and the ones before it.
+		onScope := &scope{sources: sources[:i+1]}
+		level := &joinLevel{left: joins[i].left, filter: allTrue(terms[i])}
+		if ons[i] != nil {
+			var err error
+			if level.on, _, err = compileExpr(ons[i], onScope); err != nil {
+				return nil, err
+			}
+		}
+		candidates := conjuncts(ons[i])
+		if !level.left {
+			// a LEFT JOIN's WHERE terms are checked after a row of NULLs was put in for no match.
+			candidates = append(candidates, termExprs[i]...)
+		}
+		for _, term := range candidates {
+			if lookup, ok := joinLookupOf(term, i, onScope); ok {
+				level.lookups = append(level.lookups, lookup)
+			}
+		}
+		p.levels = append(p.levels, level)
+	}
+	return p, nil
+}
+
+// Equalities of USING (or NATURAL) between the table at i and the first table before it having the column.
+// The column of the table at i is then only reachable by its qualified name.
+func usingTerms(sources []sourceTable, i int, join joinOperator) ([]sql.Expr, error) {
+	names := join.using
+	if join.natural {
+		for _, col := range sources[i].table.tableSpec.Columns {
+			if si, _ := leftColumn(sources[:i], col.Name); si >= 0 {
+				names = append(names, col.Name)
+			}
+		}
+	}
+	var terms []sql.Expr
+	for _, name := range names {
+		ci, ok := sources[i].table.ColumnIndex(name)
+		si, _ := leftColumn(sources[:i], name)
+		if !ok || si < 0 {
+			return nil, fmt.Errorf("cannot join using column %s - column not present in both tables", name)
+		}
+		if sources[i].hidden == nil {
+			sources[i].hidden = map[int]bool{}
+		}
+		sources[i].hidden[ci] = true
+		terms = append(terms, &sql.BinaryExpr{
+			Op: sql.EQ,
+			X:  &sql.QualifiedRef{Table: &sql.Ident{Name: sources[si].name}, Column: &sql.Ident{Name: name}},
+			Y:  &sql.QualifiedRef{Table: &sql.Ident{Name: sources[i].name}, Column: &sql.Ident{Name: name}},
+		})
+	}
+	return terms, nil
+}
+
+// The first source having the (unqualified reachable) column, -1 for none.
+func leftColumn(sources []sourceTable, name string) (int, int) {
+	for si, src := range sources {
+		if ci, ok := src.table.ColumnIndex(name); ok && !src.hidden[ci] {
+			return si, ci
+		}
+	}
+	return -1, -1
+}
+
+// Whether the term is `column = value` for a column of the table at level, with a value from the tables before it.
+func joinLookupOf(term sql.Expr, level int, sc *scope) (joinLookup, bool) {
+	for {
+		paren, ok := term.(*sql.ParenExpr)
+		if !ok {
+			break
+		}
+		term = paren.X
+	}
+	eq, ok := term.(*sql.BinaryExpr)
+	if !ok || eq.Op != sql.EQ {
+		return joinLookup{}, false
+	}
+	for _, sides := range [][2]sql.Expr{{eq.X, eq.Y}, {eq.Y, eq.X}} {
+		si, ci, ok := columnReference(sides[0], sc)
+		if !ok || si != level {
+			continue
+		}
+		valueLevel := 0
+		ev, valueAffinity, err := compileExpr(sides[1], sc.recordingLevel(&valueLevel))
+		if err != nil || valueLevel >= level {
+			continue
+		}
+		// only usable when the comparison converts the value rather than the column.
+		affinity := sc.sources[si].table.columnAffinity(ci)
+		if !affinity.IsNumeric() && (valueAffinity.IsNumeric() || (affinity == btree.BlobAffinity && valueAffinity != btree.BlobAffinity)) {
+			continue
+		}
+		return joinLookup{column: ci, value: ev, affinity: affinity, collation: comparisonCollation(eq.X, eq.Y, sc)}, true
+	}
+	return joinLookup{}, false
+}
+
+// The rows of the table at level i matching the rows before it (in env), with ON and WHERE checked.
+func (p *joinPlan) open(i int, env *evalEnv) (rowIterator, error) {
+	level := p.levels[i-1]
+	tbl := p.sources[i].table
+	var rows rowIterator
+	if len(level.lookups) > 0 {
+		terms := map[string]*columnConstraint{}
+		for _, lookup := range level.lookups {
+			v, err := lookup.value(env)
+			if err != nil {
+				return nil, err
+			}
+			v = v.ApplyAffinity(lookup.affinity)
+			if v.IsNull() || (tbl.isRowid(lookup.column) && v.Class() != btree.IntegerClass) {
+				// nothing can be equal.
+				rows = &sliceRows{}
+				break
+			}
+			terms[tbl.columnName(lookup.column)] = &columnConstraint{values: []btree.Value{v}, collation: lookup.collation}
+		}
+		if rows == nil {
+			var err error
+			if rows, err = tbl.openPath(level.path.withConstraints(tbl, terms), nil); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var err error
+		if rows, err = tbl.openPath(level.path, nil); err != nil {
+			return nil, err
+		}
+	}
+	rows = keepIf(rows, i, env, level.on)
+	if level.left {
+		rows = &outerJoinRows{rowIterator: rows}
+	}
+	return keepIf(rows, i, env, level.filter), nil
+}
+
+// Rows that make the condition true once put at position i of env. (all of them when there is no condition)
+func keepIf(rows rowIterator, i int, env *evalEnv, condition evaluator) rowIterator {
+	if condition == nil {
+		return rows
+	}
+	return &filteredRows{
+		rowIterator: rows,
+		keep: func(row Row) (bool, error) {
+			env.rows[i] = row
+			v, err := condition(env)
+			isTrue, _ := truth(v)
+			return isTrue, err
+		},
+	}
+}
+
+// Every combination of rows of the joined tables, the rows of the first table coming from `first`.
+// The env is reused from one combination to the next.
+func (p *joinPlan) envs(first rowIterator) *envIterator {
+	env := &evalEnv{rows: make([]Row, len(p.sources))}
+	open := []rowIterator{first}
+	return &envIterator{
+		next: func() (*evalEnv, bool, error) {
+			for {
+				i := len(open) - 1
+				if !open[i].Next() {
+					if err := open[i].Err(); err != nil || i == 0 {
+						return nil, false, err
+					}
+					open[i].Close()
+					open = open[:i]
+					continue
+				}
+				env.rows[i] = open[i].Row()
+				if i == len(p.sources)-1 {
+					return env, true, nil
+				}
+				rows, err := p.open(i+1, env)
+				if err != nil {
+					return nil, false, err
+				}
+				open = append(open, rows)
+			}
+		},
+		close: func() error {
+			var err error
+			for i := len(open) - 1; i >= 0; i-- {
+				if closeErr := open[i].Close(); closeErr != nil && err == nil {
+					err = closeErr
+				}
+			}
+			open = open[:1]
+			return err
+		},
+	}
+}
+
+// Choose the cheapest way to read each table, unless done already.
+func (p *joinPlan) choose() {
+	if p.path != nil {
+		return
+	}
+	first := p.sources[0]
+	path := cheapestPath(first.table.accessPaths(p.where, first.used))
+	p.path = &path
+	debugf("Access path: %s\n", path.describe(first.name))
+
+	for i, level := range p.levels {
+		src := p.sources[i+1]
+		// the values are only known once the tables before have a row.
+		lookupTerms := map[string]*columnConstraint{}
+		for _, lookup := range level.lookups {
+			lookupTerms[src.table.columnName(lookup.column)] = &columnConstraint{values: []btree.Value{{}}, collation: lookup.collation}
+		}
+		level.path = cheapestPath(src.table.accessPaths(lookupTerms, src.used))
+		if !level.path.lookedUp() {
+			level.lookups = nil
+		}
+		debugf("Access path: %s\n", level.path.describe(src.name))
+	}
+}
+
+// Make the first table's rows come in the order of the ORDER BY keys, choosing its path again with the cost of
+// sorting the rows it reads. Returns whether the rows still need sorting. (joined rows keep the order of the first
+// table's rows)
+func (p *joinPlan) orderBy(keys []orderingKey) bool {
+	return !p.follow(keys, false)
+}
+
+// Make equal GROUP BY keys come together, like orderBy. Returns whether the rows can be grouped while reading.
+func (p *joinPlan) groupBy(keys []orderingKey) bool {
+	return p.follow(keys, true)
+}
+
+func (p *joinPlan) follow(keys []orderingKey, anyDirection bool) bool {
+	p.choose()
+	if len(keys) == 0 {
+		return true
+	}
+	first := p.sources[0]
+	tbl := first.table
+	paths := tbl.accessPaths(p.where, first.used)
+	// every index keeps its order when read in full, looking up the table rows if it has to.
+	for _, idx := range tbl.assocIndices {
+		if idx.complete() && !idx.covers(tbl, first.used) {
+			paths = append(paths, idx.scanPath(tbl, false, false))
+		}
+	}
+	best, bestCost, ordered := 0, 0.0, false
+	for i := range paths {
+		keeps := tbl.keepsOrder(&paths[i], keys, anyDirection)
+		cost := paths[i].cost
+		if !keeps {
+			cost += sortCost(paths[i].rows)
+		}
+		if i == 0 || cost < bestCost {
+			best, bestCost, ordered = i, cost, keeps
+		}
+	}
+	*p.path = paths[best]
+	debugf("Access path: %s, ordered=%v\n", p.path.describe(first.name), ordered)
+	return ordered
+}
+
+// Whether equal keys come together in the rows of the chosen path, which stays as it is.
+func (p *joinPlan) keepsTogether(keys []orderingKey) bool {
+	p.choose()
+	path := *p.path
+	return p.sources[0].table.keepsOrder(&path, keys, true)
+}
+
+// Rows of the first table, through the chosen path.
+func (p *joinPlan) firstRows() (rowIterator, error) {
+	p.choose()
+	first := p.sources[0].table
+	if first.view != nil {
+		// read only once, the view's rows are taken as its SELECT produces them. (see explainViews)
+		rows, err := first.streamView()
+		if err != nil {
+			return nil, err
+		}
+		return first.filterRows(rows, p.predicate), nil
+	}
+	return first.openPath(*p.path, p.predicate)
+}
+
+// The lines of EXPLAIN QUERY PLAN for reading the tables.
+func (p *joinPlan) explain() []string {
+	p.choose()
+	lines := []string{p.path.describe(p.sources[0].name)}
+	for i, level := range p.levels {
+		line := level.path.describe(p.sources[i+1].name)
+		if level.left {
+			line += " LEFT-JOIN"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// The rows of a LEFT JOIN's table; a single row of NULLs when there are none.
+type outerJoinRows struct {
+	rowIterator
+	matched bool
+	nulls   bool // at the row of NULLs.
+}
+
+func (o *outerJoinRows) Next() bool {
+	if o.nulls {
+		o.nulls = false
+		return false
+	}
+	if o.rowIterator.Next() {
+		o.matched = true
+		return true
+	}
+	if o.matched || o.rowIterator.Err() != nil {
+		return false
+	}
+	o.matched = true
+	o.nulls = true
+	return true
+}
+
+func (o *outerJoinRows) Row() Row {
+	if o.nulls {
+		return Row{}
+	}
+	return o.rowIterator.Row()
+}
+
+// Terms of the top level ANDs.
+func conjuncts(expr sql.Expr) []sql.Expr {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *sql.ParenExpr:
+		return conjuncts(e.X)
+	case *sql.BinaryExpr:
+		if e.Op == sql.AND {
+			return append(conjuncts(e.X), conjuncts(e.Y)...)
+		}
+	}
+	return []sql.Expr{expr}
+}
+
+// The terms ANDed together, nil when there are none.
+func conjunction(terms []sql.Expr) sql.Expr {
+	var expr sql.Expr
+	for _, term := range terms {
+		if expr == nil {
+			expr = term
+		} else {
+			expr = &sql.BinaryExpr{Op: sql.AND, X: expr, Y: term}
+		}
+	}
+	return expr
+}
+
+// True when all terms are, nil when there are none.
+func allTrue(terms []evaluator) evaluator {
+	switch len(terms) {
+	case 0:
+		return nil
+	case 1:
+		return terms[0]
+	}
+	return func(env *evalEnv) (btree.Value, error) {
+		for _, term := range terms {
+			v, err := term(env)
+			if err != nil {
+				return v, err
+			}
+			if isTrue, _ := truth(v); !isTrue {
+				return btree.IntegerValue(0), nil
+			}
+		}
+		return btree.IntegerValue(1), nil
+	}
+}
+
+// Describe the join order for debugging, e.g. "a LEFT JOIN b".
+func (p *joinPlan) String() string {
+	var b strings.Builder
+	b.WriteString(p.sources[0].name)
+	for i, level := range p.levels {
+		if level.left {
+			b.WriteString(" LEFT")
+		}
+		b.WriteString(" JOIN ")
+		b.WriteString(p.sources[i+1].name)
+	}
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"unicode/utf8"
+)
+
+// LIKE: '%' matches any sequence, '_' a single character. Case insensitive for ASCII letters only, same as SQLite.
+// escape < 0 means there is no ESCAPE character.
+func likeMatch(pattern string, s string, escape rune) bool {
+	for len(pattern) > 0 {
+		p, size := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[size:]
+		switch {
+		case p == escape:
+			if len(pattern) == 0 {
+				return false
+			}
+			p, size = utf8.DecodeRuneInString(pattern)
+			pattern = pattern[size:]
+			if len(s) == 0 {
+				return false
+			}
+			c, size := utf8.DecodeRuneInString(s)
+			if asciiLower(c) != asciiLower(p) {
+				return false
+			}
+			s = s[size:]
+		case p == '%':
+			// collapse consecutive wildcards, a trailing % matches everything.
+			for len(pattern) > 0 && (pattern[0] == '%' || pattern[0] == '_') {
+				if pattern[0] == '_' {
+					if len(s) == 0 {
+						return false
+					}
+					_, size := utf8.DecodeRuneInString(s)
+					s = s[size:]
+				}
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for {
+				if likeMatch(pattern, s, escape) {
+					return true
+				}
+				if len(s) == 0 {
+					return false
+				}
+				_, size := utf8.DecodeRuneInString(s)
+				s = s[size:]
+			}
+		case p == '_':
+			if len(s) == 0 {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			s = s[size:]
+		default:
+			if len(s) == 0 {
+				return false
+			}
+			c, size := utf8.DecodeRuneInString(s)
+			if asciiLower(c) != asciiLower(p) {
+				return false
+			}
+			s = s[size:]
+		}
+	}
+	return len(s) == 0
+}
+
+func asciiLower(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + ('a' - 'A')
+	}
+	return r
+}
+
+// GLOB: '*' matches any sequence, '?' a single character, [abc] / [a-z] / [^abc] a character class. Case sensitive.
+func globMatch(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		p, size := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[size:]
+		switch p {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for {
+				if globMatch(pattern, s) {
+					return true
+				}
+				if len(s) == 0 {
+					return false
+				}
+				_, size := utf8.DecodeRuneInString(s)
+				s = s[size:]
+			}
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			s = s[size:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			c, size := utf8.DecodeRuneInString(s)
+			rest, matched, ok := matchCharClass(pattern, c)
+			if !ok || !matched {
+				return false
+			}
+			pattern = rest
+			s = s[size:]
+		default:
+			if len(s) == 0 {
+				return false
+			}
+			c, size := utf8.DecodeRuneInString(s)
+			if c != p {
+				return false
+			}
+			s = s[size:]
+		}
+	}
+	return len(s) == 0
+}
+
+// Match c against the class right after '['. Returns the pattern after the closing ']'; ok is false when it is not closed.
+func matchCharClass(pattern string, c rune) (string, bool, bool) {
+	invert := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		invert = true
+		pattern = pattern[1:]
+	}
+	matched := false
+	first := true
+	prev := rune(-1)
+	for len(pattern) > 0 {
+		r, size := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[size:]
+		switch {
+		case r == ']' && !first:
+			return pattern, matched != invert, true
+		case r == '-' && prev >= 0 && len(pattern) > 0 && pattern[0] != ']':
+			// a range, e.g. a-z
+			hi, size := utf8.DecodeRuneInString(pattern)
+			pattern = pattern[size:]
+			if c >= prev && c <= hi {
+				matched = true
+			}
+			prev = -1
+		default:
+			if r == c {
+				matched = true
+			}
+			prev = r
+		}
+		first = false
+	}
+	return pattern, false, false
+}
@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// Evaluate LIMIT and OFFSET. A negative limit means no limit, a negative offset is 0.
+func compileLimit(selectStmt *sql.SelectStatement) (int64, int64, error) {
+	limitExpr, offsetExpr := selectStmt.LimitExpr, selectStmt.OffsetExpr
+	if selectStmt.OffsetComma.IsValid() {
+		// LIMIT <offset>, <limit>
+		limitExpr, offsetExpr = offsetExpr, limitExpr
+	}
+	limit, offset := int64(-1), int64(0)
+	var err error
+	if limitExpr != nil {
+		if limit, err = evalLimitTerm(limitExpr); err != nil {
+			return 0, 0, err
+		}
+	}
+	if offsetExpr != nil {
+		if offset, err = evalLimitTerm(offsetExpr); err != nil {
+			return 0, 0, err
+		}
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	return limit, offset, nil
+}
+
+// LIMIT/OFFSET take any constant expression that evaluates to an integer.
+func evalLimitTerm(expr sql.Expr) (int64, error) {
+	ev, _, err := compileExpr(expr, &scope{})
+	if err != nil {
+		return 0, err
+	}
+	v, err := ev(&evalEnv{})
+	if err != nil {
+		return 0, err
+	}
+	v = v.ApplyAffinity(btree.NumericAffinity)
+	if v.Class() != btree.IntegerClass {
+		return 0, fmt.Errorf("datatype mismatch")
+	}
+	return v.Integer(), nil
+}
+
+// Skip the first `offset` rows and stop after `limit` rows (negative means no limit).
+// The underlying rows are closed as soon as the limit is reached so no more pages are read.
+func limitRows(rows *Rows, limit int64, offset int64) *Rows {
+	if limit < 0 && offset == 0 {
+		return rows
+	}
+	next := rows.next
+	skipped := int64(0)
+	produced := int64(0)
+	var closeErr error
+	rows.next = func() ([]btree.Value, bool, error) {
+		if limit >= 0 && produced >= limit {
+			return nil, false, closeErr
+		}
+		for ; skipped < offset; skipped++ {
+			if _, ok, err := next(); !ok || err != nil {
+				return nil, false, err
+			}
+		}
+		values, ok, err := next()
+		if ok && err == nil {
+			produced++
+			if produced == limit && rows.close != nil {
+				// that was the last row, no need to wait for the caller to ask for one more.
+				close := rows.close
+				rows.close = nil
+				closeErr = close()
+			}
+		}
+		return values, ok, err
+	}
+	return rows
+}
@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// The underlying rows are closed with the last row of the limit, before the caller asks for more.
+func TestLimitRowsCloses(t *testing.T) {
+	read, closed := 0, 0
+	rows := &Rows{
+		next: func() ([]btree.Value, bool, error) {
+			read++
+			return []btree.Value{btree.IntegerValue(int64(read))}, true, nil
+		},
+		close: func() error {
+			closed++
+			return nil
+		},
+	}
+	rows = limitRows(rows, 2, 1)
+	var got []int64
+	for rows.Next() {
+		got = append(got, rows.Values()[0].Integer())
+		if len(got) == 2 && closed != 1 {
+			t.Errorf("the underlying rows are not closed after the last row")
+		}
+	}
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("LIMIT 2 OFFSET 1 gave %v, want [2 3]", got)
+	}
+	rows.Close()
+	if closed != 1 || read != 3 {
+		t.Errorf("closed %d times after reading %d rows, want once after 3", closed, read)
+	}
+}
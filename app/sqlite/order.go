@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// A compiled ORDER BY term.
+type orderingKey struct {
+	eval       evaluator
+	column     int // column of the first table (of FROM) when the term is a plain column reference, otherwise -1
+	desc       bool
+	nullsFirst bool
+	collation  string // TEXT values compare by it; the collation of the column the term refers to, or BINARY.
+}
+
+// Compile ORDER BY terms. A term that is an integer literal refers to a result column (1-based).
+func compileOrderBy(terms []*sql.OrderingTerm, sc *scope, resultColumns []resultColumn) ([]orderingKey, error) {
+	keys := make([]orderingKey, len(terms))
+	for t, term := range terms {
+		desc := term.Desc.IsValid()
+		key := orderingKey{
+			column:     -1,
+			desc:       desc,
+			nullsFirst: !desc, // NULL is the smallest value.
+			collation:  "BINARY",
+		}
+		if term.NullsFirst.IsValid() {
+			key.nullsFirst = true
+		} else if term.NullsLast.IsValid() {
+			key.nullsFirst = false
+		}
+		x, termScope := term.X, sc
+		if ref, ok := x.(*sql.Ident); ok {
+			// ORDER BY looks at the result column aliases first.
+			if aliased, ok := sc.aliases[strings.ToLower(ref.Name)]; ok {
+				x, termScope = aliased, sc.withoutAliases()
+			}
+		}
+		switch x := x.(type) {
+		case *sql.NumberLit:
+			n, err := numberLiteral(x.Value)
+			if err != nil || n.Class() != btree.IntegerClass {
+				break
+			}
+			if n.Integer() < 1 || n.Integer() > int64(len(resultColumns)) {
+				return nil, fmt.Errorf("%s ORDER BY term out of range - should be between 1 and %d", ordinal(t+1), len(resultColumns))
+			}
+			key.column = resultColumns[n.Integer()-1].column
+			key.eval = resultColumns[n.Integer()-1].eval
+			key.collation = resultColumns[n.Integer()-1].collation
+		case *sql.Ident, *sql.QualifiedRef, *sql.ParenExpr:
+			if si, ci, ok := columnReference(x, termScope); ok && si == 0 {
+				key.column = ci
+			}
+			key.collation, _ = exprCollation(x, termScope)
+		}
+		if key.eval == nil {
+			ev, _, err := compileExpr(x, termScope)
+			if err != nil {
+				return nil, err
+			}
+			key.eval = ev
+		}
+		keys[t] = key
+	}
+	return keys, nil
+}
+
+func ordinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return fmt.Sprintf("%dth", n)
+	case n%10 == 1:
+		return fmt.Sprintf("%dst", n)
+	case n%10 == 2:
+		return fmt.Sprintf("%dnd", n)
+	case n%10 == 3:
+		return fmt.Sprintf("%drd", n)
+	}
+	return fmt.Sprintf("%dth", n)
+}
+
+// Compare records whose first len(keys) values are the ordering keys.
+func compareByKeys(keys []orderingKey) func(a, b []btree.Value) int {
+	return func(a, b []btree.Value) int {
+		for k, key := range keys {
+			x, y := a[k], b[k]
+			var c int
+			switch {
+			case x.IsNull() && y.IsNull():
+				c = 0
+			case x.IsNull():
+				c = 1
+				if key.nullsFirst {
+					c = -1
+				}
+			case y.IsNull():
+				c = -1
+				if key.nullsFirst {
+					c = 1
+				}
+			default:
+				c = btree.CompareCollated(x, y, key.collation)
+				if key.desc {
+					c = -c
+				}
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+// Whether the keys are in the natural order of the rowid, which all table lookups yield.
+func (t *DBTable) orderedByRowid(keys []orderingKey) bool {
+	return len(keys) > 0 && t.isRowid(keys[0].column) && !keys[0].desc
+}
+
+// Whether the rows of the path come in the order of the keys, setting it to walk the index backwards when that
+// is what it takes. (e.g. all keys DESC on ASC columns) With anyDirection, for GROUP BY, equal keys only need to
+// come together.
+func (t *DBTable) keepsOrder(path *accessPath, keys []orderingKey, anyDirection bool) bool {
+	if path.kind == scanAccess && t.primaryKey != nil {
+		// a WITHOUT ROWID table is scanned in the order of its PRIMARY KEY.
+		ok, reverse := t.indexKeepsOrder(t.primaryKey, 0, keys, anyDirection)
+		path.reverse = reverse
+		return ok
+	}
+	if path.kind != indexAccess {
+		// table rows and rowid lookups come in rowid order.
+		return t.orderedByRowid(keys)
+	}
+	if len(path.seeks) == 1 && path.use.equal == len(path.index.columns) && !path.use.lower && !path.use.upper {
+		// entries equal in every column are in rowid order.
+		return t.orderedByRowid(keys)
+	}
+	// the seeks come in index order, so do the columns after the equal ones of a single seek.
+	starts := []int{0}
+	if len(path.seeks) == 1 && path.use.equal > 0 {
+		starts = append(starts, path.use.equal)
+	}
+	for _, start := range starts {
+		if ok, reverse := t.indexKeepsOrder(path.index, start, keys, anyDirection); ok {
+			path.reverse = reverse
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the index columns from `start` on are the keys, and whether to walk it backwards for their order.
+func (t *DBTable) indexKeepsOrder(idx *DBIndex, start int, keys []orderingKey, anyDirection bool) (bool, bool) {
+	if len(keys) == 0 || len(idx.columns)-start < len(keys) {
+		return false, false
+	}
+	reverse := keys[0].desc != idx.columns[start].desc
+	for k, key := range keys {
+		col := idx.columns[start+k]
+		ci, ok := t.ColumnIndex(col.name)
+		if !ok || key.column < 0 || ci != key.column || col.collation != key.collation {
+			return false, false
+		}
+		if anyDirection {
+			continue
+		}
+		// NULLs come first in ascending index order, walking backwards puts them last.
+		if key.nullsFirst == key.desc || key.desc != (col.desc != reverse) {
+			return false, false
+		}
+	}
+	return true, reverse && !anyDirection
+}
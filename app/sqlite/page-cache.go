@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"container/list"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// Same default as SQLite: a negative size is in KiB, so roughly 2MB worth of pages.
+const DEFAULT_CACHE_SIZE = -2000
+
+// Counters of the page cache since the database was opened.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Pages     int // pages currently cached
+	Capacity  int // max pages to keep
+}
+
+type cachedPage struct {
+	pageIndex int64
+	page      *btree.TableBTreePage
+}
+
+// Least recently used pages are dropped once the cache holds `capacity` pages.
+type pageCache struct {
+	capacity int
+	entries  map[int64]*list.Element // pageIndex ~> element of `order`
+	order    *list.List              // most recently used at the front.
+	stats    CacheStats
+}
+
+func newPageCache(capacity int) *pageCache {
+	c := &pageCache{
+		entries: map[int64]*list.Element{},
+		order:   list.New(),
+	}
+	c.resize(capacity)
+	return c
+}
+
+// Convert a cache_size setting into number of pages. Positive means pages, negative means KiB.
+func cacheSizeInPages(cacheSize int, pageSize uint32) int {
+	if cacheSize >= 0 {
+		return cacheSize
+	}
+	return int(-int64(cacheSize) * 1024 / int64(pageSize))
+}
+
+func (c *pageCache) get(pageIndex int64) (*btree.TableBTreePage, bool) {
+	elem, ok := c.entries[pageIndex]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedPage).page, true
+}
+
+func (c *pageCache) put(pageIndex int64, page *btree.TableBTreePage) {
+	if elem, ok := c.entries[pageIndex]; ok {
+		elem.Value.(*cachedPage).page = page
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.capacity <= 0 {
+		return
+	}
+	c.entries[pageIndex] = c.order.PushFront(&cachedPage{pageIndex: pageIndex, page: page})
+	c.evict()
+}
+
+// Change the capacity, dropping the least recently used pages when shrinking.
+func (c *pageCache) resize(capacity int) {
+	if capacity < 0 {
+		capacity = 0
+	}
+	c.capacity = capacity
+	c.evict()
+}
+
+func (c *pageCache) evict() {
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedPage).pageIndex)
+		c.stats.Evictions++
+	}
+}
+
+func (c *pageCache) snapshot() CacheStats {
+	stats := c.stats
+	stats.Pages = c.order.Len()
+	stats.Capacity = c.capacity
+	return stats
+}
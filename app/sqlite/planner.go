@@ -0,0 +1,447 @@
+package sqlite
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// Without statistics a table is assumed to be this big, like sqlite3 does.
+const ASSUMED_TABLE_ROWS = 1 << 20
+
+// Rows an equality on the leading column of an index is assumed to match.
+const ASSUMED_EQUALITY_ROWS = 10
+
+// How the rows of a table are read.
+type accessKind int
+
+const (
+	scanAccess       accessKind = iota // every row, in rowid order. (PRIMARY KEY order for a WITHOUT ROWID table)
+	rowidAccess                        // rows of given rowids.
+	rowidRangeAccess                   // rows within a range of rowids.
+	indexAccess                        // rows of the index entries of some seeks, in index order.
+)
+
+// One way to read the rows of a table, with its estimated cost.
+type accessPath struct {
+	kind     accessKind
+	rowIds   []int64 // rowidAccess
+	from, to int64   // rowidRangeAccess, inclusive.
+	index    *DBIndex
+	seeks    []indexSeek // indexAccess; a single empty seek reads the whole index.
+	use      seekUse
+	reverse  bool    // index entries backwards.
+	covering bool    // the index has all the columns the query reads; the table itself is not read.
+	terms    string  // the constraints used, as EXPLAIN QUERY PLAN shows them. e.g. "a=? AND b>?"
+	rows     float64 // estimated
+	cost     float64
+}
+
+// Relative cost of reading a row of the table, from the declared types of its columns like sqlite3 estimates it.
+func (t *DBTable) columnWidth(columnIndex int) float64 {
+	if t.isRowid(columnIndex) {
+		// the rowid itself, not stored in the record.
+		return 0
+	}
+	if t.columnAffinity(columnIndex).IsNumeric() || t.tableSpec.Columns[columnIndex].Type == "" {
+		return 1
+	}
+	return 5
+}
+
+func (t *DBTable) rowWidth() float64 {
+	width := 1.0
+	for ci := range t.tableSpec.Columns {
+		width += t.columnWidth(ci)
+	}
+	return width
+}
+
+func (i *DBIndex) entryWidth(t *DBTable) float64 {
+	width := 1.0
+	for _, col := range i.columns {
+		if col.expr != nil {
+			width += t.exprWidth(col.expr)
+		} else if ci, ok := t.ColumnIndex(col.name); ok {
+			width += t.columnWidth(ci)
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// Relative width of an expression's value, as wide as the widest column it reads. e.g. lower(name) is a text.
+func (t *DBTable) exprWidth(expr sql.Expr) float64 {
+	width := 1.0
+	sql.Walk(sql.VisitFunc(func(node sql.Node) error {
+		// the column of a qualified reference is an identifier too.
+		if ident, ok := node.(*sql.Ident); ok {
+			if ci, ok := t.ColumnIndex(ident.Name); ok {
+				width = max(width, t.columnWidth(ci))
+			}
+		}
+		return nil
+	}), expr)
+	return width
+}
+
+// Whether the index has all the (used) columns, the rowid being part of every entry.
+func (i *DBIndex) covers(t *DBTable, used map[int]bool) bool {
+	if i.primaryKey {
+		return true
+	}
+	for ci := range used {
+		if t.isRowid(ci) {
+			continue
+		}
+		if t.virtualColumn(ci) != nil {
+			// computed from columns the index may not have.
+			return false
+		}
+		found := false
+		for _, col := range i.columns {
+			if indexed, ok := t.ColumnIndex(col.name); ok && indexed == ci {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the index holds every row of the table. (a partial index, with WHERE, does not)
+func (i *DBIndex) complete() bool {
+	return i.indexSpec.WhereExpr == nil
+}
+
+// Ways to read the rows matching the constraints, reading only the used columns. The full scan comes first.
+func (t *DBTable) accessPaths(where map[string]*columnConstraint, used map[int]bool) []accessPath {
+	n := float64(ASSUMED_TABLE_ROWS)
+	lookup := math.Log2(n)
+	rowWidth := t.rowWidth()
+	paths := []accessPath{{kind: scanAccess, rows: n, cost: n * rowWidth}}
+
+	if rowIds, ok := t.rowidLookup(where); ok {
+		k := float64(len(rowIds))
+		paths = append(paths, accessPath{kind: rowidAccess, rowIds: rowIds, terms: "rowid=?", rows: k, cost: k * (lookup + rowWidth)})
+	} else if c, ok := where[t.rowIdAliasName()]; ok && (c.lower != nil || c.upper != nil) {
+		path := rowidRange(c)
+		path.rows = n
+		for _, bound := range []*indexBound{c.lower, c.upper} {
+			if bound != nil {
+				path.rows /= 4
+			}
+		}
+		path.cost = lookup + path.rows*rowWidth
+		paths = append(paths, path)
+	}
+
+	// like sqlite3, the latest index comes first. (and wins a tie) The PRIMARY KEY of a WITHOUT ROWID table
+	// is the table itself, its scan is the one above.
+	indices := t.assocIndices
+	if t.primaryKey != nil {
+		indices = append([]*DBIndex{t.primaryKey}, indices...)
+	}
+	for k := len(indices) - 1; k >= 0; k-- {
+		idx := indices[k]
+		if !idx.complete() {
+			continue
+		}
+		covering := idx.covers(t, used)
+		entryWidth := idx.entryWidth(t)
+		seeks, use := idx.seeksFor(where)
+		if use.used() {
+			rows := idx.estimateRows(use, n) * float64(len(seeks))
+			cost := float64(len(seeks))*lookup + rows*entryWidth
+			if !covering {
+				cost += rows * (lookup + rowWidth)
+			}
+			paths = append(paths, accessPath{
+				kind: indexAccess, index: idx, seeks: seeks, use: use, covering: covering,
+				terms: idx.seekTerms(use), rows: rows, cost: cost,
+			})
+		} else if covering && !idx.primaryKey {
+			paths = append(paths, idx.scanPath(t, true, false))
+		}
+	}
+	return paths
+}
+
+// The range of rowids of the bounds.
+func rowidRange(c *columnConstraint) accessPath {
+	path := accessPath{kind: rowidRangeAccess, from: math.MinInt64, to: math.MaxInt64}
+	empty := false
+	var terms []string
+	if c.lower != nil {
+		path.from = c.lower.value.Integer()
+		if !c.lower.inclusive {
+			empty = path.from == math.MaxInt64
+			path.from++
+		}
+		terms = append(terms, "rowid>?")
+	}
+	if c.upper != nil {
+		path.to = c.upper.value.Integer()
+		if !c.upper.inclusive {
+			empty = empty || path.to == math.MinInt64
+			path.to--
+		}
+		terms = append(terms, "rowid<?")
+	}
+	if empty {
+		path.from, path.to = 1, 0
+	}
+	path.terms = strings.Join(terms, " AND ")
+	return path
+}
+
+// Reading every entry of the index.
+func (i *DBIndex) scanPath(t *DBTable, covering bool, reverse bool) accessPath {
+	n := float64(ASSUMED_TABLE_ROWS)
+	cost := n * i.entryWidth(t)
+	if !covering {
+		cost += n * (math.Log2(n) + t.rowWidth())
+	}
+	return accessPath{kind: indexAccess, index: i, seeks: []indexSeek{{}}, covering: covering, reverse: reverse, rows: n, cost: cost}
+}
+
+// Rows a seek is assumed to match; each bound of a range keeps a quarter.
+func (i *DBIndex) estimateRows(use seekUse, n float64) float64 {
+	rows := n
+	if use.equal > 0 {
+		rows = ASSUMED_EQUALITY_ROWS / math.Pow(2, float64(use.equal-1))
+		if i.indexSpec.Unique.IsValid() && use.equal >= i.keyColumns {
+			rows = 1
+		}
+	}
+	if use.lower {
+		rows /= 4
+	}
+	if use.upper {
+		rows /= 4
+	}
+	return max(rows, 1)
+}
+
+// Cost of sorting the rows; each is written to the sorter and read back.
+func sortCost(rows float64) float64 {
+	if rows <= 1 {
+		return 0
+	}
+	return 2 * rows * math.Log2(rows)
+}
+
+// The cheapest of the paths, the first one of those costing the same. Like sqlite3, reading some rows by their rowid
+// beats reading every entry of an index, however narrow.
+func cheapestPath(paths []accessPath) accessPath {
+	byRowid := false
+	for _, path := range paths {
+		byRowid = byRowid || path.kind == rowidAccess || path.kind == rowidRangeAccess
+	}
+	best := paths[0]
+	for _, path := range paths[1:] {
+		if byRowid && path.kind == indexAccess && !path.use.used() {
+			continue
+		}
+		if path.cost < best.cost {
+			best = path
+		}
+	}
+	return best
+}
+
+// Whether the path reads the table through its rowid or an index lookup, rather than all of it.
+func (p *accessPath) lookedUp() bool {
+	return p.kind == rowidAccess || p.kind == rowidRangeAccess || (p.kind == indexAccess && p.use.used())
+}
+
+// The path, as a line of EXPLAIN QUERY PLAN. e.g. "SEARCH t USING INDEX i (a=? AND b>?)"
+func (p *accessPath) describe(name string) string {
+	switch p.kind {
+	case rowidAccess, rowidRangeAccess:
+		return fmt.Sprintf("SEARCH %s USING INTEGER PRIMARY KEY (%s)", name, p.terms)
+	case indexAccess:
+		if p.index.primaryKey {
+			return fmt.Sprintf("SEARCH %s USING PRIMARY KEY (%s)", name, p.terms)
+		}
+		using := "INDEX"
+		if p.covering {
+			using = "COVERING INDEX"
+		}
+		if !p.use.used() {
+			return fmt.Sprintf("SCAN %s USING %s %s", name, using, p.index.Name())
+		}
+		return fmt.Sprintf("SEARCH %s USING %s %s (%s)", name, using, p.index.Name(), p.terms)
+	}
+	return "SCAN " + name
+}
+
+// The same path looking up the constraints' values, which are only known while running. (e.g. of a join)
+func (p accessPath) withConstraints(t *DBTable, where map[string]*columnConstraint) accessPath {
+	switch {
+	case p.kind == rowidAccess:
+		p.rowIds, _ = t.rowidLookup(where)
+	case p.kind == indexAccess && p.use.used():
+		p.seeks, _ = p.index.seeksFor(where)
+	}
+	return p
+}
+
+// Iterate through the rows of the path, checking the WHERE clause (may be nil).
+func (t *DBTable) openPath(path accessPath, predicate evaluator) (rowIterator, error) {
+	var candidates rowIterator
+	switch {
+	case path.kind == rowidAccess:
+		debugf("Selecting rowid= %v\n", path.rowIds)
+		// SelectRowsByIds sorts what it is given.
+		found, err := t.SelectRowsByIds(append([]int64{}, path.rowIds...))
+		if err != nil {
+			return nil, err
+		}
+		candidates = &sliceRows{rows: found}
+	case path.kind == rowidRangeAccess:
+		debugf("Selecting rowid from %d to %d\n", path.from, path.to)
+		candidates = t.NewRangeCursor(path.from, path.to)
+	case t.view != nil:
+		rows, err := t.materializeView()
+		if err != nil {
+			return nil, err
+		}
+		candidates = &sliceRows{rows: rows}
+	case t.rootPage == 0:
+		// nothing stored. (see TEMP_SCHEMA_TABLE_NAMES)
+		candidates = &sliceRows{}
+	case path.kind == indexAccess || t.primaryKey != nil:
+		if path.kind == scanAccess {
+			// a WITHOUT ROWID table is all in its PRIMARY KEY b-tree, walked as it is read.
+			candidates = newCoveringRows(t, t.primaryKey, t.primaryKey.NewIndexCursor(nil, path.reverse))
+			break
+		}
+		// the entries are read as the rows are wanted, a LIMIT stops the walk.
+		entries := path.index.newSeekCursor(path.seeks, path.reverse)
+		if path.covering || path.index.primaryKey {
+			candidates = newCoveringRows(t, path.index, entries)
+		} else {
+			candidates = &indexOrderedRows{table: t, index: path.index, entries: entries}
+		}
+	default:
+		candidates = t.NewCursor()
+	}
+	return t.filterRows(candidates, predicate), nil
+}
+
+// The rows that satisfy the WHERE clause, all of them when predicate is nil.
+func (t *DBTable) filterRows(candidates rowIterator, predicate evaluator) rowIterator {
+	if predicate == nil {
+		return candidates
+	}
+	return &filteredRows{
+		rowIterator: candidates,
+		keep: func(row Row) (bool, error) {
+			return t.applyFilter(predicate, row)
+		},
+	}
+}
+
+// Index entries one at a time. (see IndexCursor)
+type entryIterator interface {
+	Next() bool
+	Entry() []btree.TableBTreeLeafPageCellField
+	Err() error
+	Close() error
+}
+
+// Entries already collected.
+type sliceEntries struct {
+	entries [][]btree.TableBTreeLeafPageCellField
+	fields  []btree.TableBTreeLeafPageCellField
+}
+
+func (s *sliceEntries) Next() bool {
+	if len(s.entries) == 0 {
+		s.fields = nil
+		return false
+	}
+	s.fields = s.entries[0]
+	s.entries = s.entries[1:]
+	return true
+}
+
+func (s *sliceEntries) Entry() []btree.TableBTreeLeafPageCellField {
+	return s.fields
+}
+
+func (s *sliceEntries) Err() error {
+	return nil
+}
+
+func (s *sliceEntries) Close() error {
+	s.entries = nil
+	return nil
+}
+
+// Rows made of index entries alone; the columns not in the index are NULL, they are not used.
+type coveringRows struct {
+	table   *DBTable
+	index   *DBIndex
+	entries entryIterator
+	columns []int // table column of each index column, -1 for none.
+	row     Row
+	err     error
+}
+
+func newCoveringRows(t *DBTable, idx *DBIndex, entries entryIterator) *coveringRows {
+	columns := make([]int, len(idx.columns))
+	for k, col := range idx.columns {
+		columns[k] = -1
+		if ci, ok := t.ColumnIndex(col.name); ok {
+			columns[k] = ci
+		}
+	}
+	return &coveringRows{table: t, index: idx, entries: entries, columns: columns}
+}
+
+func (c *coveringRows) Next() bool {
+	if c.err != nil || !c.entries.Next() {
+		return false
+	}
+	fields := c.entries.Entry()
+	values := make([]btree.Value, len(c.table.tableSpec.Columns))
+	for k, ci := range c.columns {
+		// a record of a WITHOUT ROWID table lacks the columns added after it was written.
+		if ci >= 0 && k < len(fields) {
+			values[ci] = fields[k].Value()
+		} else if ci >= 0 {
+			values[ci] = c.table.columnDefault(ci)
+		}
+	}
+	rowid, err := c.index.entryRowid(fields)
+	if err != nil {
+		c.err = err
+		return false
+	}
+	c.row = materializedRow(c.table, rowid, values)
+	return true
+}
+
+func (c *coveringRows) Row() Row {
+	return c.row
+}
+
+func (c *coveringRows) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.entries.Err()
+}
+
+func (c *coveringRows) Close() error {
+	return c.entries.Close()
+}
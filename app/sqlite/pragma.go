@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// PRAGMA name [= value] or PRAGMA name(value). rqlite/sql does not parse these so we scan the tokens ourselves.
+type pragmaStatement struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// Returns nil when the query is not a PRAGMA statement.
+func parsePragma(query string) (*pragmaStatement, error) {
+	scanner := sql.NewScanner(strings.NewReader(query))
+	next := func() (sql.Token, string) {
+		for {
+			_, tok, lit := scanner.Scan()
+			if tok != sql.SPACE && tok != sql.COMMENT {
+				return tok, lit
+			}
+		}
+	}
+	if tok, _ := next(); tok != sql.PRAGMA {
+		return nil, nil
+	}
+	tok, lit := next()
+	if tok != sql.IDENT && tok != sql.QIDENT {
+		return nil, fmt.Errorf("near \"%s\": syntax error", lit)
+	}
+	name := lit
+	tok, lit = next()
+	if tok == sql.DOT {
+		// schema name, only "main" exists in a read-only database file.
+		if !strings.EqualFold(name, "main") {
+			return nil, fmt.Errorf("unknown database %s", name)
+		}
+		if tok, lit = next(); tok != sql.IDENT && tok != sql.QIDENT {
+			return nil, fmt.Errorf("near \"%s\": syntax error", lit)
+		}
+		name = lit
+		tok, lit = next()
+	}
+	stmt := &pragmaStatement{name: strings.ToLower(name)}
+
+	closing := sql.ILLEGAL
+	switch tok {
+	case sql.EQ:
+	case sql.LP:
+		closing = sql.RP
+	case sql.SEMI, sql.EOF:
+		return stmt, nil
+	default:
+		return nil, fmt.Errorf("near \"%s\": syntax error", lit)
+	}
+	sign := ""
+	tok, lit = next()
+	if tok == sql.MINUS || tok == sql.PLUS {
+		sign = lit
+		tok, lit = next()
+	}
+	switch tok {
+	case sql.INTEGER, sql.FLOAT, sql.IDENT, sql.STRING:
+		stmt.value, stmt.hasValue = sign+lit, true
+	default:
+		return nil, fmt.Errorf("near \"%s\": syntax error", lit)
+	}
+	tok, lit = next()
+	if closing != sql.ILLEGAL {
+		if tok != closing {
+			return nil, fmt.Errorf("near \"%s\": syntax error", lit)
+		}
+		tok, lit = next()
+	}
+	if tok != sql.SEMI && tok != sql.EOF {
+		return nil, fmt.Errorf("near \"%s\": syntax error", lit)
+	}
+	return stmt, nil
+}
+
+func (d *Db) pragma(stmt *pragmaStatement) (*Rows, error) {
+	switch stmt.name {
+	case "cache_size":
+		if !stmt.hasValue {
+			return singleRow([]string{"cache_size"}, []btree.Value{btree.IntegerValue(int64(d.CacheSize()))}), nil
+		}
+		cacheSize, err := strconv.Atoi(stmt.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache_size %s", stmt.value)
+		}
+		d.SetCacheSize(cacheSize)
+		return &Rows{columns: []string{}}, nil
+	default:
+		return nil, fmt.Errorf("PRAGMA %s is not yet supported", stmt.name)
+	}
+}
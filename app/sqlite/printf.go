@@ -0,0 +1,472 @@
+package sqlite
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// A parsed %-conversion of printf().
+type printfSpec struct {
+	leftAlign bool // -
+	plus      bool // +
+	space     bool // ' '
+	zeroPad   bool // 0
+	alternate bool // #
+	alt2      bool // ! (characters instead of bytes for %s, more digits and no trailing zeros for reals)
+	comma     bool // , (thousands separators)
+	width     int
+	precision int // -1 when not given
+	verb      byte
+}
+
+// Format like SQLite's printf(). Missing arguments count as NULL.
+// An unknown conversion ends the output, the same as SQLite does.
+//
+// See https://www.sqlite.org/printf.html
+func sqlitePrintf(format string, args []btree.Value) string {
+	var out strings.Builder
+	nextArg := func() btree.Value {
+		if len(args) == 0 {
+			return btree.NullValue()
+		}
+		v := args[0]
+		args = args[1:]
+		return v
+	}
+	i := 0
+	for i < len(format) {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			i++
+			continue
+		}
+		i++
+		if i >= len(format) {
+			out.WriteByte('%')
+			break
+		}
+		spec := printfSpec{precision: -1}
+	flags:
+		for ; i < len(format); i++ {
+			switch format[i] {
+			case '-':
+				spec.leftAlign = true
+			case '+':
+				spec.plus = true
+			case ' ':
+				spec.space = true
+			case '0':
+				spec.zeroPad = true
+			case '#':
+				spec.alternate = true
+			case '!':
+				spec.alt2 = true
+			case ',':
+				spec.comma = true
+			default:
+				break flags
+			}
+		}
+		if i < len(format) && format[i] == '*' {
+			spec.width = int(nextArg().Integer())
+			if spec.width < 0 {
+				spec.leftAlign = true
+				spec.width = -spec.width
+			}
+			i++
+		} else {
+			for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+				spec.width = spec.width*10 + int(format[i]-'0')
+			}
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			spec.precision = 0
+			if i < len(format) && format[i] == '*' {
+				spec.precision = int(nextArg().Integer())
+				if spec.precision < 0 {
+					spec.precision = -spec.precision
+				}
+				i++
+			} else {
+				for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+					spec.precision = spec.precision*10 + int(format[i]-'0')
+				}
+			}
+		}
+		// length modifiers (%lld) make no difference here.
+		for i < len(format) && format[i] == 'l' {
+			i++
+		}
+		if i >= len(format) {
+			break
+		}
+		spec.verb = format[i]
+		i++
+		switch spec.verb {
+		case 'd', 'i', 'u', 'x', 'X', 'o':
+			out.WriteString(spec.pad(formatInteger(nextArg().Integer(), spec)))
+		case 'f', 'e', 'E', 'g', 'G':
+			v := nextArg()
+			out.WriteString(spec.pad(formatFloat(v.Numeric().Float64(), spec)))
+		case 's', 'z':
+			out.WriteString(spec.pad(spec.truncate(nextArg().Text())))
+		case 'c':
+			s := nextArg().Text()
+			if s == "" {
+				out.WriteString(spec.pad(""))
+				break
+			}
+			ch, _ := utf8.DecodeRuneInString(s)
+			repeat := 1
+			if spec.precision > 1 {
+				repeat = spec.precision
+			}
+			out.WriteString(spec.pad(strings.Repeat(string(ch), repeat)))
+		case 'q', 'Q', 'w':
+			v := nextArg()
+			quote := "'"
+			if spec.verb == 'w' {
+				quote = "\""
+			}
+			switch {
+			case v.IsNull() && spec.verb == 'Q':
+				out.WriteString(spec.pad("NULL"))
+			case v.IsNull():
+				out.WriteString(spec.pad("(NULL)"))
+			default:
+				s := strings.ReplaceAll(spec.truncate(v.Text()), quote, quote+quote)
+				if spec.verb == 'Q' {
+					s = quote + s + quote
+				}
+				out.WriteString(spec.pad(s))
+			}
+		case '%':
+			out.WriteByte('%')
+		case 'n':
+		default:
+			return out.String()
+		}
+	}
+	return out.String()
+}
+
+// Length of s as printf() counts it; bytes, or characters with the ! flag.
+func (spec printfSpec) length(s string) int {
+	if spec.alt2 {
+		return utf8.RuneCountInString(s)
+	}
+	return len(s)
+}
+
+// Cut a string argument to the precision.
+func (spec printfSpec) truncate(s string) string {
+	if spec.precision < 0 || spec.length(s) <= spec.precision {
+		return s
+	}
+	if !spec.alt2 {
+		return s[:spec.precision]
+	}
+	n := 0
+	for i := range s {
+		if n == spec.precision {
+			return s[:i]
+		}
+		n++
+	}
+	return s
+}
+
+// Pad to the width with spaces.
+func (spec printfSpec) pad(s string) string {
+	missing := spec.width - spec.length(s)
+	if missing <= 0 {
+		return s
+	}
+	if spec.leftAlign {
+		return s + strings.Repeat(" ", missing)
+	}
+	return strings.Repeat(" ", missing) + s
+}
+
+// Pad with zeros between the sign (or 0x) and the digits, for the 0 flag.
+func (spec printfSpec) zeroFill(prefix string, digits string) string {
+	if spec.zeroPad && !spec.leftAlign {
+		if missing := spec.width - len(prefix) - len(digits); missing > 0 {
+			digits = strings.Repeat("0", missing) + digits
+		}
+	}
+	return prefix + digits
+}
+
+func (spec printfSpec) sign(negative bool) string {
+	switch {
+	case negative:
+		return "-"
+	case spec.plus:
+		return "+"
+	case spec.space:
+		return " "
+	}
+	return ""
+}
+
+func formatInteger(n int64, spec printfSpec) string {
+	var digits, prefix string
+	switch spec.verb {
+	case 'd', 'i':
+		magnitude := uint64(n)
+		if n < 0 {
+			magnitude = uint64(-n)
+		}
+		digits = strconv.FormatUint(magnitude, 10)
+		prefix = spec.sign(n < 0)
+	case 'u':
+		digits = strconv.FormatUint(uint64(n), 10)
+	case 'x', 'X':
+		digits = strconv.FormatUint(uint64(n), 16)
+		if spec.verb == 'X' {
+			digits = strings.ToUpper(digits)
+		}
+		if spec.alternate && n != 0 {
+			prefix = "0" + string(spec.verb)
+		}
+	case 'o':
+		digits = strconv.FormatUint(uint64(n), 8)
+		if spec.alternate && n != 0 {
+			prefix = "0"
+		}
+	}
+	if len(digits) < spec.precision {
+		digits = strings.Repeat("0", spec.precision-len(digits)) + digits
+	}
+	if spec.comma && (spec.verb == 'd' || spec.verb == 'i' || spec.verb == 'u') {
+		digits = groupThousands(digits)
+	}
+	// SQLite zero pads integers even when left aligned.
+	spec.leftAlign = false
+	return spec.zeroFill(prefix, digits)
+}
+
+func groupThousands(digits string) string {
+	var b strings.Builder
+	for i, ch := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+// Significant decimal digits of |f| with the exponent of the first digit, the same way as SQLite's sqlite3FpDecode():
+// f is scaled to an integer of about 19 digits with double-double arithmetic, then rounded half-up to n digits.
+// No more than `limit` digits are ever significant. n <= 0 counts -n digits from the decimal point instead.
+func decimalDigits(f float64, n int, limit int) ([]byte, int) {
+	r := math.Abs(f)
+	if r == 0 {
+		return []byte{'0'}, 0
+	}
+	exp := 0
+	rr := [2]float64{r, 0}
+	if rr[0] > 9.223372036854774784e+18 {
+		for rr[0] > 9.223372036854774784e+118 {
+			exp += 100
+			dekkerMul2(&rr, 1.0e-100, -1.99918998026028836196e-117)
+		}
+		for rr[0] > 9.223372036854774784e+28 {
+			exp += 10
+			dekkerMul2(&rr, 1.0e-10, -3.6432197315497741579e-27)
+		}
+		for rr[0] > 9.223372036854774784e+18 {
+			exp += 1
+			dekkerMul2(&rr, 1.0e-01, -5.5511151231257827021e-18)
+		}
+	} else {
+		for rr[0] < 9.223372036854774784e-83 {
+			exp -= 100
+			dekkerMul2(&rr, 1.0e+100, -1.5902891109759918046e+83)
+		}
+		for rr[0] < 9.223372036854774784e+07 {
+			exp -= 10
+			dekkerMul2(&rr, 1.0e+10, 0)
+		}
+		for rr[0] < 9.22337203685477478e+17 {
+			exp -= 1
+			dekkerMul2(&rr, 1.0e+01, 0)
+		}
+	}
+	var v uint64
+	if rr[1] < 0 {
+		v = uint64(rr[0]) - uint64(-rr[1])
+	} else {
+		v = uint64(rr[0]) + uint64(rr[1])
+	}
+	digits := []byte(strconv.FormatUint(v, 10))
+	point := len(digits) + exp // digits before the decimal point
+	if n <= 0 {
+		n = point - n
+		if n == 0 && digits[0] >= '5' {
+			digits = append([]byte{'0'}, digits...)
+			point++
+			n = 1
+		}
+	}
+	if n > 0 && (n < len(digits) || len(digits) > limit) {
+		if n > limit {
+			n = limit
+		}
+		roundUp := digits[n] >= '5'
+		digits = digits[:n]
+		for j := n - 1; roundUp; j-- {
+			if j < 0 {
+				digits = append([]byte{'1'}, digits...)
+				point++
+				break
+			}
+			digits[j]++
+			roundUp = digits[j] > '9'
+			if roundUp {
+				digits[j] = '0'
+			}
+		}
+	}
+	for len(digits) > 1 && digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+	}
+	if digits[0] == '0' {
+		// rounded to nothing.
+		return []byte{'0'}, point - 1
+	}
+	return digits, point - 1
+}
+
+// x *= y (+ yy, the error of y) in double-double arithmetic.
+func dekkerMul2(x *[2]float64, y float64, yy float64) {
+	hx := math.Float64frombits(math.Float64bits(x[0]) & 0xfffffffffc000000)
+	tx := x[0] - hx
+	hy := math.Float64frombits(math.Float64bits(y) & 0xfffffffffc000000)
+	ty := y - hy
+	p := float64(hx * hy)
+	q := float64(hx*ty) + float64(tx*hy)
+	c := p + q
+	cc := p - c + q + float64(tx*ty)
+	cc = float64(x[0]*yy) + float64(x[1]*y) + cc
+	x[0] = c + cc
+	x[1] = c - x[0]
+	x[1] += cc
+}
+
+// Digit i (0 being the first significant one), or 0 past the end.
+func digitAt(digits []byte, i int) byte {
+	if i < 0 || i >= len(digits) {
+		return '0'
+	}
+	return digits[i]
+}
+
+func formatFloat(f float64, spec printfSpec) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return spec.sign(false) + "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	limit := 16
+	if spec.alt2 {
+		limit = 26
+	}
+	precision := spec.precision
+	if precision < 0 {
+		precision = 6
+	}
+	verb := spec.verb
+	trimZeros := spec.alt2
+	if verb == 'g' || verb == 'G' {
+		if precision == 0 {
+			precision = 1
+		}
+		_, exponent := decimalDigits(f, precision, limit)
+		if exponent < -4 || exponent >= precision {
+			verb, precision = verb-'g'+'e', precision-1
+		} else {
+			verb, precision = 'f', precision-1-exponent
+		}
+		trimZeros = !spec.alternate
+	}
+
+	var body string
+	switch verb {
+	case 'f':
+		digits, exponent := decimalDigits(f, -precision, limit)
+		if string(digits) == "0" {
+			exponent = 0
+		}
+		var b strings.Builder
+		if exponent < 0 {
+			b.WriteByte('0')
+		}
+		for i := 0; i <= exponent; i++ {
+			b.WriteByte(digitAt(digits, i))
+		}
+		if precision > 0 || spec.alternate || spec.alt2 {
+			b.WriteByte('.')
+		}
+		for i := 0; i < precision; i++ {
+			b.WriteByte(digitAt(digits, exponent+1+i))
+		}
+		body = b.String()
+	default: // e, E
+		digits, exponent := decimalDigits(f, precision+1, limit)
+		var b strings.Builder
+		b.WriteByte(digits[0])
+		if precision > 0 || spec.alternate || spec.alt2 {
+			b.WriteByte('.')
+		}
+		for i := 1; i <= precision; i++ {
+			b.WriteByte(digitAt(digits, i))
+		}
+		mantissa := b.String()
+		if trimZeros {
+			mantissa = trimFraction(mantissa, spec.alt2)
+		}
+		sign := "+"
+		if exponent < 0 {
+			sign, exponent = "-", -exponent
+		}
+		e := strconv.Itoa(exponent)
+		if len(e) < 2 {
+			e = "0" + e
+		}
+		body = mantissa + string(verb) + sign + e
+		trimZeros = false
+	}
+	if trimZeros {
+		body = trimFraction(body, spec.alt2)
+	}
+	return spec.zeroFill(spec.sign(f < 0), body)
+}
+
+// Remove trailing zeros of the fraction (and the point); keepOne leaves at least ".0".
+func trimFraction(s string, keepOne bool) string {
+	if !strings.Contains(s, ".") {
+		if keepOne {
+			return s + ".0"
+		}
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	if strings.HasSuffix(s, ".") {
+		if keepOne {
+			return s + "0"
+		}
+		return strings.TrimSuffix(s, ".")
+	}
+	return s
+}
@@ -0,0 +1,231 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// A compiled result column.
+type resultColumn struct {
+	eval      evaluator
+	column    int            // column of the first table (of FROM) when it is a plain column reference, otherwise -1
+	affinity  btree.Affinity // of the expression; BLOB (none) unless it is a column reference. (see compileExpr)
+	collation string         // the column's when it is a column reference, otherwise BINARY.
+}
+
+// Compile the result columns, expanding `*` and `tbl.*`. Returns the columns with their names as sqlite3 reports them:
+// the alias, the declared name for a column reference, otherwise the expression as written. (see selectListText)
+func compileResultColumns(columns []*sql.ResultColumn, sc *scope, texts []string) ([]resultColumn, []string, error) {
+	var results []resultColumn
+	var names []string
+	for c, column := range columns {
+		if column.Star.IsValid() {
+			for si := range sc.sources {
+				var err error
+				if results, names, err = expandSource(sc, si, results, names, false); err != nil {
+					return nil, nil, err
+				}
+			}
+			continue
+		}
+		if ref, ok := column.Expr.(*sql.QualifiedRef); ok && ref.Star.IsValid() {
+			found := false
+			for si, src := range sc.sources {
+				if strings.EqualFold(src.name, ref.Table.Name) {
+					var err error
+					if results, names, err = expandSource(sc, si, results, names, true); err != nil {
+						return nil, nil, err
+					}
+					found = true
+				}
+			}
+			if !found {
+				return nil, nil, fmt.Errorf("no such table: %s", ref.Table.Name)
+			}
+			continue
+		}
+		ev, aff, err := compileExpr(column.Expr, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		result := resultColumn{eval: ev, column: -1, affinity: aff}
+		result.collation, _ = exprCollation(column.Expr, sc)
+		name := ""
+		if c < len(texts) {
+			name = texts[c]
+		}
+		if si, ci, ok := columnReference(column.Expr, sc); ok {
+			name = sc.sources[si].table.columnName(ci)
+			if si == 0 {
+				result.column = ci
+			}
+		}
+		if column.Alias != nil {
+			name = column.Alias.Name
+		}
+		if name == "" {
+			name = column.Expr.String()
+		}
+		results = append(results, result)
+		names = append(names, name)
+	}
+	return results, names, nil
+}
+
+// Columns of one source; `*` leaves out the ones joined by USING or NATURAL, `tbl.*` (all) does not.
+func expandSource(sc *scope, si int, results []resultColumn, names []string, all bool) ([]resultColumn, []string, error) {
+	tbl := sc.sources[si].table
+	for ci, col := range tbl.tableSpec.Columns {
+		ci := ci
+		if !all && sc.sources[si].hidden[ci] {
+			continue
+		}
+		if err := tbl.columnError(ci); err != nil {
+			return nil, nil, err
+		}
+		sc.sources[si].used[ci] = true
+		column := -1
+		if si == 0 {
+			column = ci
+		}
+		results = append(results, resultColumn{
+			eval: func(env *evalEnv) (btree.Value, error) {
+				return env.rows[si].Column(ci), nil
+			},
+			column:    column,
+			affinity:  tbl.columnAffinity(ci),
+			collation: tbl.columnCollation(ci),
+		})
+		names = append(names, col.Name)
+	}
+	return results, names, nil
+}
+
+// Whether the expression is a plain (maybe parenthesized) column reference; returns the source and column index.
+func columnReference(expr sql.Expr, sc *scope) (int, int, bool) {
+	for {
+		paren, ok := expr.(*sql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.X
+	}
+	var si, ci int
+	var err error
+	switch ref := expr.(type) {
+	case *sql.Ident:
+		si, ci, err = sc.resolve("", ref.Name)
+	case *sql.QualifiedRef:
+		if ref.Column == nil {
+			return -1, -1, false
+		}
+		si, ci, err = sc.resolve(ref.Table.Name, ref.Column.Name)
+	default:
+		return -1, -1, false
+	}
+	return si, ci, err == nil
+}
+
+// Result column aliases, for ORDER BY, GROUP BY, HAVING and WHERE to refer to.
+func resultAliases(columns []*sql.ResultColumn) map[string]sql.Expr {
+	aliases := map[string]sql.Expr{}
+	for _, column := range columns {
+		if column.Alias != nil && column.Expr != nil {
+			aliases[strings.ToLower(column.Alias.Name)] = column.Expr
+		}
+	}
+	return aliases
+}
+
+// Text of each result column of the SELECT as written, e.g. "n  +  1" in `SELECT n  +  1 AS x, s FROM t`.
+// The alias (if any) is still included; an alias is used as the name anyway.
+func selectListText(query string) []string {
+	text := []rune(query)
+	i := skipSpaceAndComments(text, 0)
+	word, end := wordAt(text, i)
+	if !strings.EqualFold(word, "select") {
+		return nil
+	}
+	i = skipSpaceAndComments(text, end)
+	if word, end := wordAt(text, i); strings.EqualFold(word, "distinct") || strings.EqualFold(word, "all") {
+		i = skipSpaceAndComments(text, end)
+	}
+	var texts []string
+	start, depth := i, 0
+	for i < len(text) {
+		switch ch := text[i]; {
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == '\'' || ch == '"' || ch == '`' || ch == '[':
+			i = skipQuoted(text, i) - 1
+		case ch == '-' && i+1 < len(text) && text[i+1] == '-', ch == '/' && i+1 < len(text) && text[i+1] == '*':
+			i = skipSpaceAndComments(text, i) - 1
+		case depth == 0 && (ch == ',' || ch == ';'):
+			texts = append(texts, strings.TrimSpace(string(text[start:i])))
+			if ch == ';' {
+				return texts
+			}
+			start = i + 1
+		case depth == 0 && (unicode.IsLetter(ch) || ch == '_'):
+			word, end := wordAt(text, i)
+			switch strings.ToLower(word) {
+			case "from", "where", "group", "having", "window", "order", "limit", "union", "intersect", "except":
+				return append(texts, strings.TrimSpace(string(text[start:i])))
+			}
+			i = end - 1
+		}
+		i++
+	}
+	return append(texts, strings.TrimSpace(string(text[start:])))
+}
+
+// Index after the quoted string or identifier starting at i.
+func skipQuoted(text []rune, i int) int {
+	closing := text[i]
+	if closing == '[' {
+		closing = ']'
+	}
+	for i++; i < len(text) && text[i] != closing; i++ {
+	}
+	return min(i+1, len(text))
+}
+
+func skipSpaceAndComments(text []rune, i int) int {
+	for i < len(text) {
+		switch {
+		case unicode.IsSpace(text[i]):
+			i++
+		case text[i] == '-' && i+1 < len(text) && text[i+1] == '-':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case text[i] == '/' && i+1 < len(text) && text[i+1] == '*':
+			i += 2
+			for i+1 < len(text) && !(text[i] == '*' && text[i+1] == '/') {
+				i++
+			}
+			i += 2
+			if i > len(text) {
+				i = len(text)
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// The identifier-like word starting at i and where it ends.
+func wordAt(text []rune, i int) (string, int) {
+	end := i
+	for end < len(text) && (unicode.IsLetter(text[end]) || unicode.IsDigit(text[end]) || text[end] == '_' || text[end] == '$') {
+		end++
+	}
+	return string(text[i:end]), end
+}
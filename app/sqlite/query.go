@@ -0,0 +1,494 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+	"github.com/rqlite/sql"
+)
+
+// Result of a query. Iterate it with Next() and read the current row with Values().
+//
+//	rows, err := db.Query("SELECT name FROM apples")
+//	defer rows.Close()
+//	for rows.Next() {
+//		fmt.Println(rows.Values()[0])
+//	}
+type Rows struct {
+	columns []string
+	next    func() ([]btree.Value, bool, error) // produce the following row; false when exhausted.
+	close   func() error
+	values  []btree.Value
+	err     error
+	// rows of EXPLAIN QUERY PLAN, see IsQueryPlan()
+	queryPlan bool
+}
+
+// Result with a single, already computed row. (e.g. count(*))
+func singleRow(columns []string, values []btree.Value) *Rows {
+	done := false
+	return &Rows{
+		columns: columns,
+		next: func() ([]btree.Value, bool, error) {
+			if done {
+				return nil, false, nil
+			}
+			done = true
+			return values, true, nil
+		},
+	}
+}
+
+// Names of the result columns.
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// Move to the next row; false when there is nothing left (or an error occurred, see Err()).
+func (r *Rows) Next() bool {
+	if r.err != nil || r.next == nil {
+		return false
+	}
+	values, ok, err := r.next()
+	if err != nil {
+		r.err = err
+	}
+	if !ok || err != nil {
+		r.values = nil
+		r.Close()
+		return false
+	}
+	r.values = values
+	return true
+}
+
+// Values of the current row, in the order of Columns().
+func (r *Rows) Values() []btree.Value {
+	return r.values
+}
+
+// Whether the rows are the steps of EXPLAIN QUERY PLAN; columns id, parent, notused and detail,
+// each step being under the one of its parent id (0 for the top).
+func (r *Rows) IsQueryPlan() bool {
+	return r.queryPlan
+}
+
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Release the underlying cursor. Safe to call more than once.
+func (r *Rows) Close() error {
+	r.next = nil
+	if r.close == nil {
+		return nil
+	}
+	close := r.close
+	r.close = nil
+	return close()
+}
+
+// Parse and run a single SQL statement.
+func (d *Db) Query(query string) (*Rows, error) {
+	pragma, err := parsePragma(query)
+	if err != nil {
+		return nil, err
+	}
+	if pragma != nil {
+		return d.pragma(pragma)
+	}
+	stmt, err := sql.NewParser(strings.NewReader(quoteKeywordNames(query))).ParseStatement()
+	if err != nil {
+		return nil, err
+	}
+	switch stmt := stmt.(type) {
+	case *sql.SelectStatement:
+		return d.selectRows(stmt, selectListText(query))
+	case *sql.ExplainStatement:
+		return d.explainQueryPlan(stmt, query)
+	default:
+		return nil, fmt.Errorf("'%s' statement is not yet supported", query)
+	}
+}
+
+// Names the parser takes for keywords, although SQLite has functions by that name.
+var keywordFunctions = map[string]bool{"replace": true}
+
+// Names the parser takes for keywords, although SQLite has columns by that name. (see ROWID_NAMES)
+var keywordColumns = map[string]bool{"rowid": true}
+
+// Quote the name of calls like `replace(..)` and of columns like `rowid`, so that they parse as such.
+func quoteKeywordNames(query string) string {
+	text := []rune(query)
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`' || ch == '[':
+			end := skipQuoted(text, i)
+			out.WriteString(string(text[i:end]))
+			i = end
+		case ch == '-' && i+1 < len(text) && text[i+1] == '-', ch == '/' && i+1 < len(text) && text[i+1] == '*':
+			end := skipSpaceAndComments(text, i)
+			out.WriteString(string(text[i:end]))
+			i = end
+		case unicode.IsLetter(ch) || ch == '_':
+			word, end := wordAt(text, i)
+			next := skipSpaceAndComments(text, end)
+			isCall := next < len(text) && text[next] == '('
+			if (keywordFunctions[strings.ToLower(word)] && isCall) || (keywordColumns[strings.ToLower(word)] && !isCall) {
+				word = "\"" + word + "\""
+			}
+			out.WriteString(word)
+			i = end
+		default:
+			out.WriteRune(ch)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// `columnTexts` are the result columns as written, see selectListText().
+func (d *Db) selectRows(selectStmt *sql.SelectStatement, columnTexts []string) (*Rows, error) {
+	selectStmt, columnTexts = d.flattenViews(selectStmt, columnTexts)
+	limit, offset, err := compileLimit(selectStmt)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := d.selectAllRows(selectStmt, columnTexts, limit, offset, nil)
+	if err != nil {
+		return nil, err
+	}
+	return limitRows(rows, limit, offset), nil
+}
+
+// The steps of EXPLAIN QUERY PLAN, collected while planning instead of reading the rows.
+type queryPlan struct {
+	details []string
+	parents []int // id of the step each one is under (1-based), 0 for the top.
+	parent  int   // of the steps added now.
+}
+
+func (p *queryPlan) add(detail ...string) {
+	for _, d := range detail {
+		p.details = append(p.details, d)
+		p.parents = append(p.parents, p.parent)
+	}
+}
+
+// Add a step, along with the ones `nested` adds under it. (e.g. the steps of a view)
+func (p *queryPlan) nest(detail string, nested func() error) error {
+	p.add(detail)
+	parent := p.parent
+	p.parent = len(p.details)
+	defer func() { p.parent = parent }()
+	return nested()
+}
+
+// EXPLAIN QUERY PLAN of a SELECT; the statement is planned but not run.
+func (d *Db) explainQueryPlan(stmt *sql.ExplainStatement, query string) (*Rows, error) {
+	selectStmt, ok := stmt.Stmt.(*sql.SelectStatement)
+	if !stmt.QueryPlan.IsValid() || !ok {
+		return nil, fmt.Errorf("'%s' statement is not yet supported", query)
+	}
+	plan := &queryPlan{}
+	if err := d.explainSelect(selectStmt, selectListText(query), plan); err != nil {
+		return nil, err
+	}
+	values := make([][]btree.Value, len(plan.details))
+	for i, detail := range plan.details {
+		values[i] = []btree.Value{btree.IntegerValue(int64(i + 1)), btree.IntegerValue(int64(plan.parents[i])), btree.IntegerValue(0), btree.TextValue(detail)}
+	}
+	return &Rows{
+		columns: []string{"id", "parent", "notused", "detail"},
+		next: func() ([]btree.Value, bool, error) {
+			if len(values) == 0 {
+				return nil, false, nil
+			}
+			row := values[0]
+			values = values[1:]
+			return row, true, nil
+		},
+		queryPlan: true,
+	}, nil
+}
+
+// Add the steps of the SELECT to the plan.
+func (d *Db) explainSelect(selectStmt *sql.SelectStatement, columnTexts []string, explain *queryPlan) error {
+	if selectStmt.Compound != nil {
+		return errCompoundSelect
+	}
+	if selectStmt.Source == nil {
+		explain.add("SCAN CONSTANT ROW")
+		return nil
+	}
+	selectStmt, columnTexts = d.flattenViews(selectStmt, columnTexts)
+	limit, offset, err := compileLimit(selectStmt)
+	if err != nil {
+		return err
+	}
+	_, err = d.selectAllRows(selectStmt, columnTexts, limit, offset, explain)
+	return err
+}
+
+// What result rows are computed from; the rows of the FROM clause, or the groups of an aggregate query.
+type envIterator struct {
+	next  func() (*evalEnv, bool, error)
+	close func() error
+}
+
+func rowEnvs(rows rowIterator) *envIterator {
+	env := &evalEnv{rows: make([]Row, 1)}
+	return &envIterator{
+		next: func() (*evalEnv, bool, error) {
+			if !rows.Next() {
+				return nil, false, rows.Err()
+			}
+			env.rows[0] = rows.Row()
+			return env, true, nil
+		},
+		close: rows.Close,
+	}
+}
+
+// Evaluate the result columns.
+func project(results []resultColumn, env *evalEnv) ([]btree.Value, error) {
+	values := make([]btree.Value, len(results))
+	for i, result := range results {
+		v, err := result.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+var errCompoundSelect = fmt.Errorf("compound SELECT (UNION, INTERSECT and EXCEPT) is not yet supported")
+
+// Rows of the SELECT before LIMIT/OFFSET; those are only passed along so the sort can keep just the top rows.
+// With `explain` the steps are added to it instead, and no rows are returned.
+func (d *Db) selectAllRows(selectStmt *sql.SelectStatement, columnTexts []string, limit int64, offset int64, explain *queryPlan) (*Rows, error) {
+	if selectStmt.Compound != nil {
+		return nil, errCompoundSelect
+	}
+	distinct := selectStmt.Distinct.IsValid()
+	if distinct {
+		// the top rows may be duplicates, the sort has to keep them all.
+		limit, offset = -1, 0
+	}
+	if selectStmt.Source == nil {
+		// a single row at most, always distinct.
+		return d.selectWithoutFrom(selectStmt, columnTexts, limit, offset)
+	}
+	sources, joins, err := d.fromSources(selectStmt.Source)
+	if err != nil {
+		return nil, err
+	}
+	// WHERE clause terms are checked as soon as the tables they refer to have a row,
+	// the first table's `column = literal` terms may pick the rowid or an index.
+	aliases := resultAliases(selectStmt.Columns)
+	plan, err := planJoin(sources, joins, selectStmt.WhereExpr, aliases)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) > 1 {
+		debugf("Join order: %s\n", plan)
+	}
+
+	if isAggregateQuery(selectStmt) {
+		q := &aggregateQuery{
+			stmt:        selectStmt,
+			plan:        plan,
+			columnTexts: columnTexts,
+			explain:     explain,
+		}
+		return d.aggregateRows(q, limit, offset)
+	}
+
+	sc := &scope{sources: sources, aliases: aliases}
+	results, colNames, err := compileResultColumns(selectStmt.Columns, sc, columnTexts)
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy, err := compileOrderBy(selectStmt.OrderingTerms, sc, results)
+	if err != nil {
+		return nil, err
+	}
+
+	distinct = distinct && !plan.rowidDistinct(distinctKeys(results))
+	needSort := plan.orderBy(orderBy)
+	// like sqlite3, duplicates that come one after the other (e.g. reading an index of the column) need no temp b-tree.
+	distinctOrdered := false
+	if distinct && len(orderBy) == 0 {
+		distinctOrdered = plan.groupBy(distinctKeys(results))
+	} else if distinct {
+		distinctOrdered = plan.keepsTogether(distinctKeys(results))
+	}
+	if explain != nil {
+		if err := d.explainViews(plan, explain); err != nil {
+			return nil, err
+		}
+		explain.add(plan.explain()...)
+		if distinct && !distinctOrdered {
+			explain.add("USE TEMP B-TREE FOR DISTINCT")
+		}
+		if needSort {
+			explain.add("USE TEMP B-TREE FOR ORDER BY")
+		}
+		return nil, nil
+	}
+	rows, err := plan.firstRows()
+	if err != nil {
+		return nil, err
+	}
+	var result *Rows
+	if needSort {
+		result = d.sortedRows(colNames, plan.envs(rows), orderBy, results, topNOf(limit, offset))
+	} else {
+		result = projectedRows(colNames, plan.envs(rows), results)
+	}
+	if distinct {
+		// sorted, the rows are no longer in the order read.
+		result = distinctRows(result, distinctKeys(results), distinctOrdered && !needSort)
+	}
+	return result, nil
+}
+
+// SELECT without FROM; the result columns are evaluated once. (e.g. `SELECT 1 + 1`)
+func (d *Db) selectWithoutFrom(selectStmt *sql.SelectStatement, columnTexts []string, limit int64, offset int64) (*Rows, error) {
+	if isAggregateQuery(selectStmt) {
+		return nil, fmt.Errorf("aggregate queries without FROM are not yet supported")
+	}
+	sc := &scope{aliases: resultAliases(selectStmt.Columns)}
+	for _, column := range selectStmt.Columns {
+		if column.Star.IsValid() {
+			return nil, fmt.Errorf("no tables specified")
+		}
+	}
+	results, colNames, err := compileResultColumns(selectStmt.Columns, sc, columnTexts)
+	if err != nil {
+		return nil, err
+	}
+	var rows rowIterator = &sliceRows{rows: []Row{{}}}
+	if selectStmt.WhereExpr != nil {
+		predicate, _, err := compileExpr(selectStmt.WhereExpr, sc)
+		if err != nil {
+			return nil, err
+		}
+		rows = &filteredRows{
+			rowIterator: rows,
+			keep: func(row Row) (bool, error) {
+				v, err := predicate(&evalEnv{rows: []Row{row}})
+				isTrue, _ := truth(v)
+				return isTrue, err
+			},
+		}
+	}
+	orderBy, err := compileOrderBy(selectStmt.OrderingTerms, sc, results)
+	if err != nil {
+		return nil, err
+	}
+	if len(orderBy) > 0 {
+		return d.sortedRows(colNames, rowEnvs(rows), orderBy, results, topNOf(limit, offset)), nil
+	}
+	return projectedRows(colNames, rowEnvs(rows), results), nil
+}
+
+// Number of rows a sort has to keep for LIMIT/OFFSET, -1 for all.
+func topNOf(limit int64, offset int64) int64 {
+	if limit < 0 {
+		return -1
+	}
+	return limit + offset
+}
+
+func projectedRows(colNames []string, src *envIterator, results []resultColumn) *Rows {
+	return &Rows{
+		columns: colNames,
+		next: func() ([]btree.Value, bool, error) {
+			env, ok, err := src.next()
+			if !ok || err != nil {
+				return nil, false, err
+			}
+			values, err := project(results, env)
+			return values, err == nil, err
+		},
+		close: src.close,
+	}
+}
+
+// Rows ordered by the keys. Nothing is read until the first Next(), which sorts everything.
+// With topN >= 0 only that many first rows are kept, in memory.
+func (d *Db) sortedRows(colNames []string, src *envIterator, orderBy []orderingKey, results []resultColumn, topN int64) *Rows {
+	var sorted *sortedRecords
+	sortAll := func() error {
+		defer src.close()
+		var s recordSorter = newSorter(compareByKeys(orderBy), d.sortMemory)
+		if topN >= 0 && topN <= MAX_TOP_N {
+			s = newTopN(compareByKeys(orderBy), int(topN))
+		}
+		for {
+			env, ok, err := src.next()
+			if err != nil {
+				s.close()
+				return err
+			}
+			if !ok {
+				break
+			}
+			// record = keys followed by the result columns.
+			record := make([]btree.Value, 0, len(orderBy)+len(results))
+			for _, key := range orderBy {
+				v, err := key.eval(env)
+				if err != nil {
+					s.close()
+					return err
+				}
+				record = append(record, v)
+			}
+			values, err := project(results, env)
+			if err != nil {
+				s.close()
+				return err
+			}
+			record = append(record, values...)
+			if err := s.add(record); err != nil {
+				s.close()
+				return err
+			}
+		}
+		result, err := s.finish()
+		if err != nil {
+			s.close()
+			return err
+		}
+		sorted = result
+		return nil
+	}
+	return &Rows{
+		columns: colNames,
+		next: func() ([]btree.Value, bool, error) {
+			if sorted == nil {
+				if err := sortAll(); err != nil {
+					return nil, false, err
+				}
+			}
+			record, ok, err := sorted.next()
+			if !ok || err != nil {
+				return nil, ok, err
+			}
+			return record[len(orderBy):], true, nil
+		},
+		close: func() error {
+			if sorted == nil {
+				return src.close()
+			}
+			return sorted.close()
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+type Row struct {
+	cell   *btree.TableBTreeLeafTablePageCell
+	table  *DBTable
+	rowid  int64         // when there is no cell
+	values []btree.Value // when there is no cell; all columns in table order. (nil means all NULL)
+}
+
+// A row made of values that were read earlier. (e.g. from a temporary file)
+func materializedRow(table *DBTable, rowid int64, values []btree.Value) Row {
+	return Row{table: table, rowid: rowid, values: values}
+}
+
+// A row of each table as a single record; for each table its rowid followed by all of its columns.
+// A row of NULLs (LEFT JOIN without a match) gets a NULL rowid.
+func joinedRecord(sources []sourceTable, rows []Row) []btree.Value {
+	var record []btree.Value
+	for si, src := range sources {
+		if rows[si].table == nil {
+			record = append(record, btree.NullValue())
+			record = append(record, make([]btree.Value, len(src.table.tableSpec.Columns))...)
+			continue
+		}
+		record = append(record, btree.IntegerValue(rows[si].Rowid()))
+		record = append(record, rows[si].Values()...)
+	}
+	return record
+}
+
+// The rows of a record made by joinedRecord.
+func joinedRows(sources []sourceTable, record []btree.Value) []Row {
+	rows := make([]Row, len(sources))
+	for si, src := range sources {
+		n := len(src.table.tableSpec.Columns)
+		if !record[0].IsNull() {
+			rows[si] = materializedRow(src.table, record[0].Integer(), record[1:1+n])
+		}
+		record = record[1+n:]
+	}
+	return rows
+}
+
+func (r *Row) Column(columnIndex int) btree.Value {
+	if r.table == nil {
+		// a row of NULLs. (e.g. bare columns of an aggregate over no rows)
+		return btree.NullValue()
+	}
+	if r.table.isRowid(columnIndex) {
+		return btree.IntegerValue(r.Rowid())
+	}
+	if g := r.table.virtualColumn(columnIndex); g != nil {
+		return g.value(r)
+	}
+	var v btree.Value
+	if r.cell == nil {
+		if columnIndex < len(r.values) {
+			v = r.values[columnIndex]
+		}
+	} else if field := r.table.recordFields[columnIndex]; field < len(r.cell.Fields) {
+		v = r.cell.Fields[field].Value()
+	} else {
+		// record written before the column was added (ALTER TABLE ADD COLUMN)
+		v = r.table.columnDefault(columnIndex)
+	}
+	if v.Class() == btree.IntegerClass && r.table.columnAffinity(columnIndex) == btree.RealAffinity {
+		// a REAL that is a whole number is stored as an integer, to save space.
+		return btree.RealValue(float64(v.Integer()))
+	}
+	return v
+}
+
+func (r *Row) Rowid() int64 {
+	if r.cell == nil {
+		return r.rowid
+	}
+	return r.cell.Rowid
+}
+
+// Values of all columns in table order.
+func (r *Row) Values() []btree.Value {
+	values := make([]btree.Value, len(r.table.tableSpec.Columns))
+	for i := range values {
+		values[i] = r.Column(i)
+	}
+	return values
+}
+
+// Rows produced one at a time. (e.g. *Cursor)
+type rowIterator interface {
+	Next() bool
+	Row() Row
+	Err() error
+	Close() error
+}
+
+// Rows that were already looked up. (e.g. by rowid)
+type sliceRows struct {
+	rows    []Row
+	current int // 1-based; 0 means before the first row.
+}
+
+func (s *sliceRows) Next() bool {
+	if s.current >= len(s.rows) {
+		return false
+	}
+	s.current++
+	return true
+}
+
+func (s *sliceRows) Row() Row {
+	return s.rows[s.current-1]
+}
+
+func (s *sliceRows) Err() error {
+	return nil
+}
+
+func (s *sliceRows) Close() error {
+	s.rows = nil
+	return nil
+}
+
+// Skip the rows of the underlying iterator that `keep` rejects.
+type filteredRows struct {
+	rowIterator
+	keep func(row Row) (bool, error)
+	err  error
+}
+
+func (f *filteredRows) Next() bool {
+	if f.err != nil {
+		return false
+	}
+	for f.rowIterator.Next() {
+		ok, err := f.keep(f.rowIterator.Row())
+		if err != nil {
+			f.err = err
+			return false
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filteredRows) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.rowIterator.Err()
+}
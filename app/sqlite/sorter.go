@@ -0,0 +1,300 @@
+package sqlite
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/peatiscoding/codecrafters-sqlite-go/app/btree"
+)
+
+// Records kept in memory before the sorter spills a sorted run to a temporary file.
+const DEFAULT_SORT_MEMORY = 16 << 20
+
+// Collects records and hands them back in order. (see sorter, topN)
+type recordSorter interface {
+	add(record []btree.Value) error
+	finish() (*sortedRecords, error)
+	close() error
+}
+
+// Sort records that may not fit in memory. (a.k.a. external merge sort)
+//
+// Records are buffered until `memoryLimit` bytes, then sorted and written to a temporary file as a run.
+// finish() merges all runs. Records that compare equal keep the order they were added in.
+type sorter struct {
+	compare       func(a, b []btree.Value) int
+	memoryLimit   int
+	buffered      [][]btree.Value
+	bufferedBytes int
+	runs          []*os.File
+}
+
+func newSorter(compare func(a, b []btree.Value) int, memoryLimit int) *sorter {
+	if memoryLimit <= 0 {
+		memoryLimit = DEFAULT_SORT_MEMORY
+	}
+	return &sorter{compare: compare, memoryLimit: memoryLimit}
+}
+
+// Rough memory used by a record.
+func recordSize(record []btree.Value) int {
+	size := 24
+	for _, v := range record {
+		size += 32 + len(v.Bytes())
+	}
+	return size
+}
+
+func (s *sorter) add(record []btree.Value) error {
+	s.buffered = append(s.buffered, record)
+	s.bufferedBytes += recordSize(record)
+	if s.bufferedBytes >= s.memoryLimit {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *sorter) sortBuffered() {
+	sort.SliceStable(s.buffered, func(i, j int) bool {
+		return s.compare(s.buffered[i], s.buffered[j]) < 0
+	})
+}
+
+// Write buffered records as a sorted run; each record is prefixed with its length.
+func (s *sorter) spill() error {
+	if len(s.buffered) == 0 {
+		return nil
+	}
+	s.sortBuffered()
+	file, err := os.CreateTemp("", "sqlite-sort-*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrIO, err)
+	}
+	// unlinked right away where possible; the open handle keeps the content.
+	os.Remove(file.Name())
+	s.runs = append(s.runs, file)
+
+	w := bufio.NewWriter(file)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for _, record := range s.buffered {
+		encoded := btree.EncodeRecord(record)
+		n := binary.PutUvarint(lenBuf, uint64(len(encoded)))
+		if _, err := w.Write(lenBuf[:n]); err != nil {
+			return fmt.Errorf("%w: %w", ErrIO, err)
+		}
+		if _, err := w.Write(encoded); err != nil {
+			return fmt.Errorf("%w: %w", ErrIO, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrIO, err)
+	}
+	debugf("sorter spilled %d records (%d bytes) into run #%d\n", len(s.buffered), s.bufferedBytes, len(s.runs))
+	s.buffered = nil
+	s.bufferedBytes = 0
+	return nil
+}
+
+// All records in order. The sorter must not be used afterwards except for close().
+func (s *sorter) finish() (*sortedRecords, error) {
+	if len(s.runs) == 0 {
+		s.sortBuffered()
+		return &sortedRecords{memory: s.buffered, sorter: s}, nil
+	}
+	if err := s.spill(); err != nil {
+		return nil, err
+	}
+	merge := &runMerge{compare: s.compare}
+	for r, file := range s.runs {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrIO, err)
+		}
+		run := &sortRun{index: r, reader: bufio.NewReader(file)}
+		ok, err := run.advance()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			merge.runs = append(merge.runs, run)
+		}
+	}
+	heap.Init(merge)
+	return &sortedRecords{merge: merge, sorter: s}, nil
+}
+
+// Release the temporary files.
+func (s *sorter) close() error {
+	for _, file := range s.runs {
+		file.Close()
+	}
+	s.runs = nil
+	s.buffered = nil
+	return nil
+}
+
+// A sorted run on disk, positioned at its current record.
+type sortRun struct {
+	index   int
+	reader  *bufio.Reader
+	current []btree.Value
+}
+
+func (r *sortRun) advance() (bool, error) {
+	size, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		r.current = nil
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIO, err)
+	}
+	encoded := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, encoded); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIO, err)
+	}
+	record, err := btree.DecodeRecord(encoded)
+	if err != nil {
+		return false, err
+	}
+	r.current = record
+	return true, nil
+}
+
+// Min-heap over the current record of each run. (container/heap)
+type runMerge struct {
+	compare func(a, b []btree.Value) int
+	runs    []*sortRun
+}
+
+func (m *runMerge) Len() int { return len(m.runs) }
+
+func (m *runMerge) Less(i, j int) bool {
+	c := m.compare(m.runs[i].current, m.runs[j].current)
+	if c == 0 {
+		// earlier runs hold the records that were added first.
+		return m.runs[i].index < m.runs[j].index
+	}
+	return c < 0
+}
+
+func (m *runMerge) Swap(i, j int) { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+
+func (m *runMerge) Push(x any) { m.runs = append(m.runs, x.(*sortRun)) }
+
+func (m *runMerge) Pop() any {
+	last := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return last
+}
+
+// Output of the sorter, from memory or merged from the runs.
+type sortedRecords struct {
+	memory  [][]btree.Value
+	current int
+	merge   *runMerge
+	sorter  *sorter
+}
+
+func (r *sortedRecords) next() ([]btree.Value, bool, error) {
+	if r.merge == nil {
+		if r.current >= len(r.memory) {
+			return nil, false, nil
+		}
+		r.current++
+		return r.memory[r.current-1], true, nil
+	}
+	if r.merge.Len() == 0 {
+		return nil, false, nil
+	}
+	run := r.merge.runs[0]
+	record := run.current
+	ok, err := run.advance()
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		heap.Fix(r.merge, 0)
+	} else {
+		heap.Pop(r.merge)
+	}
+	return record, true, nil
+}
+
+func (r *sortedRecords) close() error {
+	r.memory = nil
+	if r.sorter == nil {
+		return nil
+	}
+	return r.sorter.close()
+}
+
+// Largest LIMIT (+ OFFSET) kept by a top-N heap instead of the sorter.
+const MAX_TOP_N = 100000
+
+// Keep only the first n records in order, using a heap with the largest kept record on top. (ORDER BY .. LIMIT n)
+type topN struct {
+	compare func(a, b []btree.Value) int
+	n       int
+	items   []topItem
+	seq     int
+}
+
+type topItem struct {
+	seq    int // insertion order, breaks ties the same way the sorter does.
+	record []btree.Value
+}
+
+func newTopN(compare func(a, b []btree.Value) int, n int) *topN {
+	return &topN{compare: compare, n: n}
+}
+
+func (t *topN) less(a, b topItem) bool {
+	if c := t.compare(a.record, b.record); c != 0 {
+		return c < 0
+	}
+	return a.seq < b.seq
+}
+
+func (t *topN) Len() int           { return len(t.items) }
+func (t *topN) Less(i, j int) bool { return t.less(t.items[j], t.items[i]) } // max-heap
+func (t *topN) Swap(i, j int)      { t.items[i], t.items[j] = t.items[j], t.items[i] }
+func (t *topN) Push(x any)         { t.items = append(t.items, x.(topItem)) }
+
+func (t *topN) Pop() any {
+	last := t.items[len(t.items)-1]
+	t.items = t.items[:len(t.items)-1]
+	return last
+}
+
+func (t *topN) add(record []btree.Value) error {
+	item := topItem{seq: t.seq, record: record}
+	t.seq++
+	if len(t.items) < t.n {
+		heap.Push(t, item)
+	} else if t.n > 0 && t.less(item, t.items[0]) {
+		t.items[0] = item
+		heap.Fix(t, 0)
+	}
+	return nil
+}
+
+func (t *topN) finish() (*sortedRecords, error) {
+	sort.Slice(t.items, func(i, j int) bool {
+		return t.less(t.items[i], t.items[j])
+	})
+	records := make([][]btree.Value, len(t.items))
+	for i, item := range t.items {
+		records[i] = item.record
+	}
+	t.items = nil
+	return &sortedRecords{memory: records}, nil
+}
+
+func (t *topN) close() error {
+	t.items = nil
+	return nil
+}